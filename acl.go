@@ -0,0 +1,244 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule applies Effect to the methods matching Methods, called by a principal in Principals or with a role in Roles,
+// a rule without principals and roles applies to every caller, patterns use path.Match syntax like "admin.*"
+// with "." and "/" read the same, so "*" also matches "textDocument/hover"
+type Rule struct {
+	Effect     Effect   `json:"effect" yaml:"effect"`
+	Principals []string `json:"principals,omitempty" yaml:"principals,omitempty"`
+	Roles      []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Methods    []string `json:"methods" yaml:"methods"`
+}
+
+func (r *Rule) matches(principal *Principal, method string) bool {
+	if !matchAny(r.Methods, method) {
+		return false
+	}
+	if len(r.Principals) == 0 && len(r.Roles) == 0 {
+		return true
+	}
+	if principal == nil {
+		return false
+	}
+	if matchAny(r.Principals, principal.Name) {
+		return true
+	}
+	for _, role := range principal.Roles {
+		if matchAny(r.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		// path.Match never lets "*" match "/", so both sides use "." instead
+		if ok, _ := path.Match(strings.ReplaceAll(pattern, "/", "."), strings.ReplaceAll(s, "/", ".")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) validate() error {
+	if r.Effect != Allow && r.Effect != Deny {
+		return fmt.Errorf("effect %q, want allow or deny", r.Effect)
+	}
+	for _, patterns := range [][]string{r.Methods, r.Principals, r.Roles} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(strings.ReplaceAll(pattern, "/", "."), ""); err != nil {
+				return fmt.Errorf("pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Policy decides which principal may call which method, a matching deny rule wins over allow rules
+type Policy struct {
+	// effect when no rule matches, deny unless set to allow
+	Default Effect `json:"default,omitempty" yaml:"default,omitempty"`
+	Rules   []Rule `json:"rules" yaml:"rules"`
+}
+
+// NewPolicy returns a policy after checking the effects and patterns of its rules
+func NewPolicy(defaultEffect Effect, rules ...Rule) (*Policy, error) {
+	policy := &Policy{Default: defaultEffect, Rules: rules}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Validate reports the first bad effect or malformed pattern, a policy built by hand should be checked with it
+func (p *Policy) Validate() error {
+	if p.Default != "" && p.Default != Allow && p.Default != Deny {
+		return fmt.Errorf("default effect %q, want allow or deny", p.Default)
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Decide returns whether principal may call method, and the index of the deciding rule or -1 for the default
+func (p *Policy) Decide(principal *Principal, method string) (allowed bool, rule int) {
+	rule = -1
+	for i := range p.Rules {
+		if !p.Rules[i].matches(principal, method) {
+			continue
+		}
+		if p.Rules[i].Effect == Deny {
+			return false, i
+		}
+		if rule < 0 && p.Rules[i].Effect == Allow {
+			rule = i
+		}
+	}
+	if rule >= 0 {
+		return true, rule
+	}
+	return p.Default == Allow, -1
+}
+
+// LoadPolicyFile reads a yaml policy if filename ends with .yaml or .yml and a json policy otherwise,
+// the policy is validated
+func LoadPolicyFile(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, policy)
+	default:
+		err = json.Unmarshal(data, policy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = policy.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return policy, nil
+}
+
+// PolicyStore holds the current policy, it can be swapped while serving
+type PolicyStore struct {
+	policy atomic.Value
+}
+
+func NewPolicyStore(policy *Policy) *PolicyStore {
+	s := &PolicyStore{}
+	s.Store(policy)
+	return s
+}
+
+func (s *PolicyStore) Load() *Policy {
+	policy, _ := s.policy.Load().(*Policy)
+	return policy
+}
+
+func (s *PolicyStore) Store(policy *Policy) {
+	s.policy.Store(policy)
+}
+
+// WatchFile loads filename again whenever its modification time changes, until stop is called,
+// a file which fails to load leaves the current policy in place and is reported to onError
+func (s *PolicyStore) WatchFile(filename string, interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	var modTime time.Time
+	if info, err := os.Stat(filename); err == nil {
+		modTime = info.ModTime()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(filename)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			policy, err := LoadPolicyFile(filename)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			modTime = info.ModTime()
+			s.Store(policy)
+		}
+	}()
+	return func() { close(done) }
+}
+
+// AuditEvent records one decision of an ACLHandler
+type AuditEvent struct {
+	Time      time.Time
+	Principal *Principal
+	Method    string
+	Allowed   bool
+	// index of the deciding rule, -1 for the default
+	Rule int
+}
+
+// ACLHandler checks the principal set by AuthHandler against the policy before ServerHandler runs the request,
+// denied requests are answered with PermissionDeniedError
+type ACLHandler struct {
+	Policies *PolicyStore
+	// called with every decision, nil to skip
+	Audit func(event AuditEvent)
+	ServerHandler
+}
+
+func (h *ACLHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	principal, _ := PrincipalFromContext(request.Context())
+	allowed, rule := false, -1
+	if policy := h.Policies.Load(); policy != nil {
+		allowed, rule = policy.Decide(principal, request.Method)
+	}
+	if h.Audit != nil {
+		h.Audit(AuditEvent{Time: time.Now(), Principal: principal, Method: request.Method, Allowed: allowed, Rule: rule})
+	}
+	if !allowed {
+		writer.Write(CreateErrorResponse(request.ID, PermissionDeniedError))
+		return
+	}
+	h.ServerHandler.Handle(request, writer)
+}
@@ -0,0 +1,115 @@
+package jsonrpc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Decide(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Effect: Allow, Roles: []string{"admin"}, Methods: []string{"admin.*"}},
+		{Effect: Deny, Principals: []string{"mallory"}, Methods: []string{"*"}},
+		{Effect: Allow, Methods: []string{"public.*"}},
+	}}
+	admin := &Principal{Name: "alice", Roles: []string{"admin"}}
+	for _, c := range []struct {
+		principal *Principal
+		method    string
+		allowed   bool
+	}{
+		{admin, "admin.users.delete", true},
+		{&Principal{Name: "bob"}, "admin.users.delete", false},
+		{&Principal{Name: "mallory", Roles: []string{"admin"}}, "admin.users.delete", false},
+		{nil, "public.ping", true},
+		{nil, "private.ping", false},
+	} {
+		if allowed, _ := policy.Decide(c.principal, c.method); allowed != c.allowed {
+			t.Log(c.principal, c.method, allowed)
+			t.Fail()
+		}
+	}
+}
+
+func TestACLHandler(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(filename, []byte(`{"rules":[{"effect":"allow","methods":["svc.read"]}]}`), 0o644)
+	policy, err := LoadPolicyFile(filename)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	store := NewPolicyStore(policy)
+	stop := store.WatchFile(filename, 10*time.Millisecond, nil)
+	defer stop()
+	events := []AuditEvent{}
+	handler := &ACLHandler{Policies: store, ServerHandler: &recordHandler{}, Audit: func(event AuditEvent) {
+		events = append(events, event)
+	}}
+	request := (&ServerRequest{ID: 1, Method: "svc.write"}).WithContext(ContextWithPrincipal(context.Background(), &Principal{Name: "alice"}))
+	writer := &syncWriterForTest{}
+	handler.Handle(request, writer)
+	if len(writer.responses) != 1 || writer.responses[0].Error.Code != PermissionDeniedCode {
+		t.Log("not denied")
+		t.Fail()
+		return
+	}
+
+	os.WriteFile(filename, []byte(`{"rules":[{"effect":"allow","principals":["alice"],"methods":["svc.*"]}]}`), 0o644)
+	os.Chtimes(filename, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	time.Sleep(50 * time.Millisecond)
+	handler.Handle(request, writer)
+	if len(writer.responses) != 2 || writer.responses[1].Error != nil {
+		t.Log("policy not reloaded")
+		t.Fail()
+	}
+	if len(events) != 2 || events[0].Allowed || !events[1].Allowed || events[1].Principal.Name != "alice" {
+		t.Log("audit:", events)
+		t.Fail()
+	}
+}
+
+func TestPolicy_SlashMethods(t *testing.T) {
+	for _, pattern := range []string{"*", "textDocument*", "textDocument/*", "textDocument.*"} {
+		policy, err := NewPolicy(Allow, Rule{Effect: Deny, Methods: []string{pattern}})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			return
+		}
+		if allowed, _ := policy.Decide(nil, "textDocument/hover"); allowed {
+			t.Log(pattern, "did not deny textDocument/hover")
+			t.Fail()
+		}
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "policy.yaml")
+	os.WriteFile(yamlFile, []byte("default: allow\nrules:\n  - effect: deny\n    roles: [guest]\n    methods: [\"admin.*\"]\n"), 0o644)
+	policy, err := LoadPolicyFile(yamlFile)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if allowed, rule := policy.Decide(&Principal{Name: "bob", Roles: []string{"guest"}}, "admin.reset"); allowed || rule != 0 {
+		t.Log("yaml rule not applied")
+		t.Fail()
+	}
+	if allowed, _ := policy.Decide(nil, "public.ping"); !allowed {
+		t.Log("yaml default not applied")
+		t.Fail()
+	}
+
+	badFile := filepath.Join(dir, "bad.json")
+	os.WriteFile(badFile, []byte(`{"rules":[{"effect":"deny","methods":["admin.[*"]}]}`), 0o644)
+	if _, err = LoadPolicyFile(badFile); err == nil {
+		t.Log("bad pattern loaded")
+		t.Fail()
+	}
+}
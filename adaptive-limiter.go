@@ -0,0 +1,134 @@
+package jsonrpc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type Priority int
+
+const (
+	// shed first, may use half of the limit
+	PriorityLow Priority = iota - 1
+	// methods without a priority, may use the whole limit
+	PriorityNormal
+	// shed last, e.g. health checks, may go over the limit by half
+	PriorityCritical
+)
+
+func (p Priority) share() float64 {
+	switch {
+	case p < PriorityNormal:
+		return 0.5
+	case p > PriorityNormal:
+		return 1.5
+	default:
+		return 1
+	}
+}
+
+const adaptiveWindow = 100
+
+// AdaptiveLimiter adjusts the allowed concurrency from the latency of the handlers:
+// it grows additively while requests finish within the target latency and
+// shrinks multiplicatively when they don't
+type AdaptiveLimiter struct {
+	// latency above which the limit shrinks,
+	// 0 uses Tolerance times the smallest latency seen in the previous window of requests
+	TargetLatency time.Duration
+	Tolerance     float64
+	MinLimit      float64
+	MaxLimit      float64
+	// factor the limit is multiplied by when the latency is over the target
+	Backoff    float64
+	Priorities map[string]Priority
+
+	lock      sync.Mutex
+	limit     float64
+	inflight  int64
+	samples   int
+	windowMin time.Duration
+	baseline  time.Duration
+	now       func() time.Time
+}
+
+func NewAdaptiveLimiter(initialLimit int) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		Tolerance:  2,
+		MinLimit:   1,
+		MaxLimit:   1000,
+		Backoff:    0.9,
+		Priorities: map[string]Priority{},
+		limit:      float64(initialLimit),
+		now:        time.Now,
+	}
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int(l.limit)
+}
+
+func (l *AdaptiveLimiter) InFlight() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.inflight
+}
+
+// Allow reports whether a request of normal priority would be admitted now, it doesn't take a slot
+func (l *AdaptiveLimiter) Allow() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return float64(l.inflight) < l.limit
+}
+
+func (l *AdaptiveLimiter) Acquire(request *ServerRequest) (release func(), retryAfter time.Duration, ok bool) {
+	priority := PriorityNormal
+	if request != nil {
+		priority = l.Priorities[request.Method]
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if float64(l.inflight) >= math.Max(1, math.Floor(l.limit*priority.share())) {
+		return nil, 0, false
+	}
+	l.inflight++
+	start := l.now()
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.observe(l.now().Sub(start)) })
+	}, 0, true
+}
+
+func (l *AdaptiveLimiter) observe(latency time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	inflight := l.inflight
+	l.inflight--
+
+	if l.windowMin == 0 || latency < l.windowMin {
+		l.windowMin = latency
+	}
+	l.samples++
+	if l.samples >= adaptiveWindow {
+		l.baseline, l.windowMin, l.samples = l.windowMin, 0, 0
+	}
+
+	target := l.TargetLatency
+	if target <= 0 {
+		baseline := l.baseline
+		if baseline == 0 {
+			baseline = l.windowMin
+		}
+		target = time.Duration(float64(baseline) * l.Tolerance)
+	}
+	if latency > target {
+		l.limit = math.Max(l.MinLimit, l.limit*l.Backoff)
+	} else if float64(inflight)*2 >= l.limit {
+		// only grow while the limit is actually used
+		l.limit = math.Min(l.MaxLimit, l.limit+1/l.limit)
+	}
+}
@@ -0,0 +1,66 @@
+package jsonrpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	clock := &clockForTest{t: time.Unix(0, 0)}
+	limiter := NewAdaptiveLimiter(10)
+	limiter.TargetLatency = 100 * time.Millisecond
+	limiter.now = clock.now
+	limiter.Priorities["svc.health"] = PriorityCritical
+	limiter.Priorities["svc.report"] = PriorityLow
+
+	run := func(n int, latency time.Duration) {
+		releases := []func(){}
+		for i := 0; i < n; i++ {
+			release, _, ok := limiter.Acquire(&ServerRequest{Method: "svc.m"})
+			if ok {
+				releases = append(releases, release)
+			}
+		}
+		clock.t = clock.t.Add(latency)
+		for _, release := range releases {
+			release()
+		}
+	}
+
+	// slow handlers shrink the limit
+	for i := 0; i < 10; i++ {
+		run(10, 200*time.Millisecond)
+	}
+	shrunk := limiter.Limit()
+	if shrunk >= 10 {
+		t.Log("limit:", shrunk)
+		t.Fail()
+		return
+	}
+	// fast handlers grow it back
+	for i := 0; i < 200; i++ {
+		run(20, 10*time.Millisecond)
+	}
+	if limiter.Limit() <= shrunk {
+		t.Log("limit:", limiter.Limit())
+		t.Fail()
+	}
+
+	// at the limit, low priority is shed and critical is still admitted
+	limit := limiter.Limit()
+	for i := 0; i < limit; i++ {
+		limiter.Acquire(&ServerRequest{Method: "svc.m"})
+	}
+	if _, _, ok := limiter.Acquire(&ServerRequest{Method: "svc.report"}); ok {
+		t.Log("low priority admitted")
+		t.Fail()
+	}
+	if _, _, ok := limiter.Acquire(&ServerRequest{Method: "svc.m"}); ok {
+		t.Log("normal priority admitted over the limit")
+		t.Fail()
+	}
+	if _, _, ok := limiter.Acquire(&ServerRequest{Method: "svc.health"}); !ok {
+		t.Log("critical priority shed")
+		t.Fail()
+	}
+}
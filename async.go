@@ -0,0 +1,138 @@
+package jsonrpc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// PendingCall is a call started by ClientConn.Go, Reply is set when Done is closed and Wait returns nil
+type PendingCall struct {
+	Method string
+	Reply  interface{}
+
+	done     chan struct{}
+	lock     sync.Mutex
+	finished bool
+	err      error
+	cancel   context.CancelFunc
+	// stops the func dropping the callback when the context is done
+	stop func() bool
+}
+
+// Done is closed when the call finishes
+func (p *PendingCall) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the call finishes and returns its error
+func (p *PendingCall) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Cancel stops waiting for the response, Wait returns context.Canceled if the call hadn't finished
+func (p *PendingCall) Cancel() {
+	p.cancel()
+}
+
+func (p *PendingCall) finish(err error) {
+	p.finishWith(err, nil)
+}
+
+// finishWith runs deliver before Done is closed, only if this call is the one finishing it
+func (p *PendingCall) finishWith(err error, deliver func()) {
+	p.lock.Lock()
+	if p.finished {
+		p.lock.Unlock()
+		return
+	}
+	if deliver != nil {
+		deliver()
+	}
+	p.finished = true
+	p.err = err
+	stop := p.stop
+	p.lock.Unlock()
+	// stopped before cancel, so a finished call doesn't start the func
+	if stop != nil {
+		stop()
+	}
+	close(p.done)
+	p.cancel()
+}
+
+// receive decodes the response aside and copies it into reply only if the call isn't finished yet,
+// so a canceled call doesn't write to reply after Wait returned
+func (p *PendingCall) receive(ctx context.Context, re responseAndError, reply interface{}) {
+	v := reflect.ValueOf(reply)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		p.finish(readResponse(ctx, re, reply))
+		return
+	}
+	result := reflect.New(v.Type().Elem())
+	err := readResponse(ctx, re, result.Interface())
+	p.finishWith(err, func() {
+		if err == nil {
+			v.Elem().Set(result.Elem())
+		}
+	})
+}
+
+// afterDone runs f when ctx is done, unless the call has finished
+func (p *PendingCall) afterDone(ctx context.Context, f func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.finished {
+		p.stop = context.AfterFunc(ctx, f)
+	}
+}
+
+// Go starts a call and returns without waiting, the response is decoded on the reader goroutine
+// so no goroutine is started per call
+func (c *ClientConn) Go(ctx context.Context, serviceMethod string, args []interface{}, reply interface{}) *PendingCall {
+	ctx, cancel := context.WithCancel(ctx)
+	call := &PendingCall{Method: serviceMethod, Reply: reply, done: make(chan struct{}), cancel: cancel}
+	if atomic.LoadInt64(&c.closed) == ClientClosed {
+		call.finish(ErrShutdown)
+		return call
+	}
+	if err := ctx.Err(); err != nil {
+		call.finish(err)
+		return call
+	}
+	id, err := c.writeRequest(ctx, serviceMethod, args, func(re responseAndError) {
+		call.receive(ctx, re, reply)
+	})
+	if err != nil || id == 0 {
+		// notifications have no response
+		call.finish(err)
+		return call
+	}
+	call.afterDone(ctx, func() {
+		c.callbacks.Del(id)
+		call.finish(ctx.Err())
+	})
+	return call
+}
+
+// Result is received from injected funcs returning <-chan Result[T]
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// asyncResultType returns T if fn returns <-chan Result[T]
+func asyncResultType(fn reflect.Type) (reflect.Type, bool) {
+	if fn.NumOut() != 1 || fn.Out(0).Kind() != reflect.Chan || fn.Out(0).ChanDir() != reflect.RecvDir {
+		return nil, false
+	}
+	elem := fn.Out(0).Elem()
+	if elem.Kind() != reflect.Struct || elem.PkgPath() != reflect.TypeOf(Result[int]{}).PkgPath() ||
+		!strings.HasPrefix(elem.Name(), "Result[") {
+		return nil, false
+	}
+	return elem.Field(0).Type, true
+}
@@ -0,0 +1,149 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type asyncImpl struct {
+	release chan struct{}
+}
+
+func (a *asyncImpl) Double(i int) (int, error) {
+	return i * 2, nil
+}
+
+func (a *asyncImpl) Block() (int, error) {
+	<-a.release
+	return 0, nil
+}
+
+type asyncClient struct {
+	Double func(ctx context.Context, i int) <-chan Result[int]
+	Fail   func(i int) <-chan Result[string] `rpc:"Missing"`
+}
+
+func TestClientConn_Go(t *testing.T) {
+	impl := &asyncImpl{release: make(chan struct{})}
+	defer close(impl.release)
+	server := NewServer()
+	server.Register("svc", impl)
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+
+	blocked := conn.Go(context.Background(), "svc.Block", nil, new(int))
+	replies := make([]int, 5)
+	calls := make([]*PendingCall, len(replies))
+	for i := range calls {
+		calls[i] = conn.Go(context.Background(), "svc.Double", []interface{}{i}, &replies[i])
+	}
+	for i, call := range calls {
+		if err := call.Wait(); err != nil || replies[i] != i*2 {
+			t.Log(err, replies[i])
+			t.Fail()
+		}
+	}
+	select {
+	case <-blocked.Done():
+		t.Log("blocked call finished")
+		t.Fail()
+	default:
+	}
+	blocked.Cancel()
+	if err := blocked.Wait(); err != context.Canceled {
+		t.Log(err)
+		t.Fail()
+	}
+}
+
+// slowReplyForTest holds the decode of a response until the test lets it go
+type slowReplyForTest struct {
+	Value int
+}
+
+var slowReply struct {
+	started, proceed, decoded chan struct{}
+}
+
+func (r *slowReplyForTest) UnmarshalJSON(b []byte) error {
+	slowReply.started <- struct{}{}
+	<-slowReply.proceed
+	defer func() { slowReply.decoded <- struct{}{} }()
+	return json.Unmarshal(b, &r.Value)
+}
+
+func TestPendingCall_CancelRacesResponse(t *testing.T) {
+	slowReply.started, slowReply.proceed, slowReply.decoded = make(chan struct{}), make(chan struct{}), make(chan struct{}, 1)
+	server := NewServer()
+	server.Register("svc", &asyncImpl{})
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+
+	reply := &slowReplyForTest{}
+	call := conn.Go(context.Background(), "svc.Double", []interface{}{2}, reply)
+	// the response is being decoded when the call is canceled
+	<-slowReply.started
+	call.Cancel()
+	if err := call.Wait(); err != context.Canceled {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	// reply belongs to the caller again once Wait returned
+	reply.Value = -1
+	close(slowReply.proceed)
+	<-slowReply.decoded
+	if reply.Value != -1 {
+		t.Log("decoded into reply after cancel:", reply.Value)
+		t.Fail()
+	}
+}
+
+func TestFactory_InjectAsync(t *testing.T) {
+	server := NewServer()
+	server.Register("svc", &asyncImpl{})
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	}
+	client := &asyncClient{}
+	if err := f.Inject("svc", client); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	first, second := client.Double(context.Background(), 1), client.Double(context.Background(), 2)
+	failed := client.Fail(3)
+	if r1, r2 := <-first, <-second; r1.Err != nil || r2.Err != nil || r1.Value+r2.Value != 6 {
+		t.Log(r1, r2)
+		t.Fail()
+	}
+	var rpcErr *Error
+	if r := <-failed; !errors.As(r.Err, &rpcErr) || rpcErr.Code != MethodNotFoundCode {
+		t.Log(r)
+		t.Fail()
+	}
+
+	invalid := &struct {
+		Get func() <-chan int
+	}{}
+	if err := f.Inject("svc", invalid); err == nil {
+		t.Log("chan of int accepted")
+		t.Fail()
+	}
+}
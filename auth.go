@@ -0,0 +1,246 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuthorizationKey = "authorization"
+	KeyIDKey         = "x-key-id"
+	TimestampKey     = "x-timestamp"
+	NonceKey         = "x-nonce"
+	SignatureKey     = "x-signature"
+)
+
+// Principal is the authenticated caller
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the caller authenticated by AuthHandler, in the context of a handler
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Authenticator identifies the caller of a request
+type Authenticator interface {
+	Authenticate(request *ServerRequest) (*Principal, error)
+}
+
+// AuthHandler authenticates requests before ServerHandler runs them,
+// failures are answered with UnauthenticatedError
+type AuthHandler struct {
+	Authenticator
+	// authenticate the first request of a connection only and reuse its principal for the others
+	PerConnection bool
+	ServerHandler
+}
+
+func (h *AuthHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	var state *connState
+	if h.PerConnection {
+		state, _ = request.Context().Value(connStateKey{}).(*connState)
+	}
+	principal := state.getPrincipal()
+	if principal == nil {
+		var err error
+		principal, err = h.Authenticate(request)
+		if err != nil || principal == nil {
+			writer.Write(CreateErrorResponse(request.ID, UnauthenticatedError))
+			return
+		}
+		state.setPrincipal(principal)
+	}
+	h.ServerHandler.Handle(request.WithContext(ContextWithPrincipal(request.Context(), principal)), writer)
+}
+
+// connState is shared by the requests of a connection
+type connState struct {
+	lock      sync.Mutex
+	principal *Principal
+}
+
+type connStateKey struct{}
+
+func (s *connState) getPrincipal() *Principal {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.principal
+}
+
+func (s *connState) setPrincipal(principal *Principal) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.principal = principal
+	s.lock.Unlock()
+}
+
+// BearerAuthenticator checks the token in the "authorization" metadata, like "Bearer <token>"
+type BearerAuthenticator struct {
+	Validate func(token string) (*Principal, error)
+}
+
+// NewBearerAuthenticator panics if validate is nil, no token could pass
+func NewBearerAuthenticator(validate func(token string) (*Principal, error)) *BearerAuthenticator {
+	if validate == nil {
+		panic("jsonrpc: NewBearerAuthenticator with a nil validate func")
+	}
+	return &BearerAuthenticator{Validate: validate}
+}
+
+func (a *BearerAuthenticator) Authenticate(request *ServerRequest) (*Principal, error) {
+	scheme, token, ok := strings.Cut(request.Meta[AuthorizationKey], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" || a.Validate == nil {
+		return nil, ErrUnauthenticated
+	}
+	return a.Validate(token)
+}
+
+// HMACAuthenticator checks requests signed by HMACCredentials,
+// timestamps must be within Window and a nonce can't be used twice
+type HMACAuthenticator struct {
+	// Key returns the secret and the principal of a key id
+	Key    func(keyID string) ([]byte, *Principal, error)
+	Window time.Duration
+
+	lock   sync.Mutex
+	nonces map[string]time.Time
+	// nonces are swept at most once per Window
+	swept time.Time
+	now   func() time.Time
+}
+
+func NewHMACAuthenticator(key func(keyID string) ([]byte, *Principal, error), window time.Duration) *HMACAuthenticator {
+	return &HMACAuthenticator{
+		Key:    key,
+		Window: window,
+		nonces: map[string]time.Time{},
+		now:    time.Now,
+	}
+}
+
+func (a *HMACAuthenticator) Authenticate(request *ServerRequest) (*Principal, error) {
+	meta := request.Meta
+	millis, err := strconv.ParseInt(meta[TimestampKey], 10, 64)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	nonce := meta[NonceKey]
+	signature, err := hex.DecodeString(meta[SignatureKey])
+	if err != nil || nonce == "" {
+		return nil, ErrUnauthenticated
+	}
+	key, principal, err := a.Key(meta[KeyIDKey])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	params, err := json.Marshal(request.Params)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	expected := signRequest(key, request.Method, meta[TimestampKey], nonce, params)
+	if !hmac.Equal(signature, expected) {
+		return nil, ErrUnauthenticated
+	}
+
+	now := a.now()
+	signed := time.UnixMilli(millis)
+	if signed.Before(now.Add(-a.Window)) || signed.After(now.Add(a.Window)) {
+		return nil, ErrUnauthenticated
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if now.Sub(a.swept) >= a.Window {
+		for n, seen := range a.nonces {
+			if now.Sub(seen) > 2*a.Window {
+				delete(a.nonces, n)
+			}
+		}
+		a.swept = now
+	}
+	if _, used := a.nonces[nonce]; used {
+		return nil, ErrUnauthenticated
+	}
+	a.nonces[nonce] = now
+	return principal, nil
+}
+
+func signRequest(key []byte, method, timestamp, nonce string, params []byte) []byte {
+	sum := sha256.Sum256(params)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(sum[:])))
+	return mac.Sum(nil)
+}
+
+// CredentialProvider adds credentials to the metadata of calls
+type CredentialProvider interface {
+	Metadata(ctx context.Context, method string, params []interface{}) (map[string]string, error)
+}
+
+type BearerCredentials struct {
+	Token string
+}
+
+func (c *BearerCredentials) Metadata(ctx context.Context, method string, params []interface{}) (map[string]string, error) {
+	return map[string]string{AuthorizationKey: "Bearer " + c.Token}, nil
+}
+
+type HMACCredentials struct {
+	KeyID string
+	Key   []byte
+}
+
+func (c *HMACCredentials) Metadata(ctx context.Context, method string, params []interface{}) (map[string]string, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [16]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	nonceHex := hex.EncodeToString(nonce[:])
+	return map[string]string{
+		KeyIDKey:     c.KeyID,
+		TimestampKey: timestamp,
+		NonceKey:     nonceHex,
+		SignatureKey: hex.EncodeToString(signRequest(c.Key, method, timestamp, nonceHex, raw)),
+	}, nil
+}
+
+// CredentialsSender adds the credentials of provider to every call made through sender
+func CredentialsSender(provider CredentialProvider, sender Sender) Sender {
+	return func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+		meta, err := provider.Metadata(ctx, name, input)
+		if err != nil {
+			return err
+		}
+		for k, v := range meta {
+			ctx = WithMetadata(ctx, k, v)
+		}
+		return sender(name, ctx, input, output)
+	}
+}
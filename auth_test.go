@@ -0,0 +1,130 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type whoamiImpl struct {
+}
+
+func (w *whoamiImpl) Whoami(ctx context.Context) (string, error) {
+	principal, _ := PrincipalFromContext(ctx)
+	return principal.Name, nil
+}
+
+type whoamiClient struct {
+	Whoami func() (string, error)
+}
+
+func authServer(authenticator Authenticator) (Sender, func()) {
+	server := NewServer()
+	server.Register("svc", &whoamiImpl{})
+	server.ServerHandler = &AuthHandler{Authenticator: authenticator, ServerHandler: server.ServerHandler}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	return func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+		return conn.CallContext(ctx, name, input, output)
+	}, func() { conn.Close() }
+}
+
+func TestAuth_Bearer(t *testing.T) {
+	sender, closer := authServer(NewBearerAuthenticator(func(token string) (*Principal, error) {
+		if token != "secret" {
+			return nil, errors.New("bad token")
+		}
+		return &Principal{Name: "alice"}, nil
+	}))
+	defer closer()
+	for token, expected := range map[string]string{"secret": "alice", "wrong": ""} {
+		f := &Factory{Sender: sender, Context: context.Background(), Timeout: time.Second, Credentials: &BearerCredentials{Token: token}}
+		client := &whoamiClient{}
+		f.Inject("svc", client)
+		name, err := client.Whoami()
+		if name != expected || (expected == "" && err == nil) {
+			t.Log(token, name, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestAuth_HMAC(t *testing.T) {
+	authenticator := NewHMACAuthenticator(func(keyID string) ([]byte, *Principal, error) {
+		if keyID != "k1" {
+			return nil, nil, errors.New("unknown key")
+		}
+		return []byte("key"), &Principal{Name: "bob"}, nil
+	}, time.Minute)
+	sender, closer := authServer(authenticator)
+	defer closer()
+	f := &Factory{Sender: sender, Context: context.Background(), Timeout: time.Second, Credentials: &HMACCredentials{KeyID: "k1", Key: []byte("key")}}
+	client := &whoamiClient{}
+	f.Inject("svc", client)
+	if name, err := client.Whoami(); name != "bob" || err != nil {
+		t.Log(name, err)
+		t.Fail()
+	}
+
+	// a replayed request is rejected
+	meta, _ := (&HMACCredentials{KeyID: "k1", Key: []byte("key")}).Metadata(context.Background(), "svc.Whoami", nil)
+	request := &ServerRequest{Method: "svc.Whoami", Meta: meta}
+	if _, err := authenticator.Authenticate(request); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if _, err := authenticator.Authenticate(request); err == nil {
+		t.Log("replay accepted")
+		t.Fail()
+	}
+	// a request signed with another key is rejected
+	meta, _ = (&HMACCredentials{KeyID: "k1", Key: []byte("other")}).Metadata(context.Background(), "svc.Whoami", nil)
+	if _, err := authenticator.Authenticate(&ServerRequest{Method: "svc.Whoami", Meta: meta}); err == nil {
+		t.Log("bad signature accepted")
+		t.Fail()
+	}
+}
+
+func TestHMACAuthenticator_Sweep(t *testing.T) {
+	authenticator := NewHMACAuthenticator(func(keyID string) ([]byte, *Principal, error) {
+		return []byte("key"), &Principal{Name: "bob"}, nil
+	}, time.Minute)
+	now := time.Now()
+	authenticator.now = func() time.Time { return now }
+	authenticate := func(nonce string, nonces int) {
+		timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+		params, _ := json.Marshal([]json.RawMessage(nil))
+		request := &ServerRequest{Method: "svc.Whoami", Meta: map[string]string{
+			KeyIDKey:     "k1",
+			TimestampKey: timestamp,
+			NonceKey:     nonce,
+			SignatureKey: hex.EncodeToString(signRequest([]byte("key"), "svc.Whoami", timestamp, nonce, params)),
+		}}
+		if _, err := authenticator.Authenticate(request); err != nil || len(authenticator.nonces) != nonces {
+			t.Log(nonce, err, len(authenticator.nonces))
+			t.Fail()
+		}
+	}
+	authenticate("n1", 1)
+	now = now.Add(30 * time.Second)
+	authenticate("n2", 2)
+	// n1 and n2 are older than twice the window
+	now = now.Add(3 * time.Minute)
+	authenticate("n3", 1)
+}
+
+func TestNewBearerAuthenticator_NilValidate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Log("nil validate accepted")
+			t.Fail()
+		}
+	}()
+	NewBearerAuthenticator(nil)
+}
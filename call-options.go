@@ -0,0 +1,155 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// CallOption changes a single call, injected funcs accept them as trailing ...CallOption args
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout    time.Duration
+	retries    int
+	routingKey string
+	notify     bool
+	byName     bool
+	idempotent bool
+}
+
+var callOptionsType = reflect.TypeOf([]CallOption{})
+
+// WithCallTimeout replaces Factory.Timeout for the call
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetry sets how many times the call is retried after a connection error,
+// errors returned by the server are not retried. Once the request was written the server
+// may have run it, so later connection errors are only retried for idempotent calls
+func WithRetry(retries int) CallOption {
+	return func(o *callOptions) {
+		o.retries = retries
+	}
+}
+
+// Idempotent marks a call which may run twice, so it is also retried after a connection error
+// which happened once the request was written, like methods tagged idempotent
+func Idempotent() CallOption {
+	return func(o *callOptions) {
+		o.idempotent = true
+	}
+}
+
+// WithRoutingKey sends calls with the same key through the same pooled connection,
+// as long as the connections of the pool don't change
+func WithRoutingKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.routingKey = key
+	}
+}
+
+// AsNotification sends the call without an id, the server runs it without responding
+// and the call returns as soon as it is written, with a zero result
+func AsNotification() CallOption {
+	return func(o *callOptions) {
+		o.notify = true
+	}
+}
+
+// ByName sends the only param as the params object instead of a params array,
+// for servers whose methods take params by name
+func ByName() CallOption {
+	return func(o *callOptions) {
+		o.byName = true
+	}
+}
+
+type routingKeyKey struct{}
+
+type notificationKey struct{}
+
+type byNameKey struct{}
+
+// withCallOptions carries the options senders read from ctx
+func withCallOptions(ctx context.Context, o *callOptions) context.Context {
+	if o.routingKey != "" {
+		ctx = context.WithValue(ctx, routingKeyKey{}, o.routingKey)
+	}
+	if o.notify {
+		ctx = context.WithValue(ctx, notificationKey{}, true)
+	}
+	if o.byName {
+		ctx = context.WithValue(ctx, byNameKey{}, true)
+	}
+	return ctx
+}
+
+// routingHash returns the hash of the routing key of ctx
+func routingHash(ctx context.Context) (uint64, bool) {
+	key, ok := ctx.Value(routingKeyKey{}).(string)
+	if !ok {
+		return 0, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64(), true
+}
+
+func isNotification(ctx context.Context) bool {
+	notify, _ := ctx.Value(notificationKey{}).(bool)
+	return notify
+}
+
+func isByName(ctx context.Context) bool {
+	byName, _ := ctx.Value(byNameKey{}).(bool)
+	return byName
+}
+
+// retryable tells if err is a connection error, the request may or may not have been written
+func retryable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrShutdown) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		(errors.As(err, &netErr) && !netErr.Timeout())
+}
+
+// sendAttempt records whether a ClientConn started writing the request of an attempt
+type sendAttempt struct {
+	written int32
+}
+
+type sendAttemptKey struct{}
+
+// markWritten is called by ClientConn before it writes a request
+func markWritten(ctx context.Context) {
+	if attempt, ok := ctx.Value(sendAttemptKey{}).(*sendAttempt); ok {
+		atomic.StoreInt32(&attempt.written, 1)
+	}
+}
+
+// retry calls send again after connection errors, at most retries times while ctx is not done,
+// an error after the request was written is only retried if the call is idempotent
+func retry(ctx context.Context, retries int, idempotent bool, send func(ctx context.Context) error) error {
+	if retries <= 0 {
+		return send(ctx)
+	}
+	for i := 0; ; i++ {
+		attempt := &sendAttempt{}
+		err := send(context.WithValue(ctx, sendAttemptKey{}, attempt))
+		if err == nil || i >= retries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if !idempotent && atomic.LoadInt32(&attempt.written) == 1 {
+			// the server may have run it already
+			return err
+		}
+	}
+}
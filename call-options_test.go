@@ -0,0 +1,199 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type notifiedImpl struct {
+	received chan string
+}
+
+func (n *notifiedImpl) Record(msg string) error {
+	n.received <- msg
+	return nil
+}
+
+type notifiedClient struct {
+	Record func(ctx context.Context, msg string, opts ...CallOption) error
+}
+
+func TestCallOptions_Notification(t *testing.T) {
+	impl := &notifiedImpl{received: make(chan string, 2)}
+	server := NewServer()
+	server.Register("svc", impl)
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	}
+	client := &notifiedClient{}
+	if err := f.Inject("svc", client); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if err := client.Record(context.Background(), "fire", AsNotification()); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if err := client.Record(context.Background(), "call"); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	// requests are handled concurrently
+	if first, second := <-impl.received, <-impl.received; first+second != "firecall" && first+second != "callfire" {
+		t.Log(first, second)
+		t.Fail()
+	}
+
+	req := &ServerRequest{}
+	json.Unmarshal([]byte(`{"jsonrpc":"2.0","method":"svc.Record","params":["x"]}`), req)
+	if !req.IsNotification() || req.Method != "svc.Record" {
+		t.Log("notification not detected")
+		t.Fail()
+	}
+	json.Unmarshal([]byte(`{"jsonrpc":"2.0","method":"svc.Record","id":0}`), req)
+	if req.IsNotification() {
+		t.Log("id 0 taken as a notification")
+		t.Fail()
+	}
+}
+
+type retriedClient struct {
+	Get func(opts ...CallOption) (int, error)
+}
+
+func TestCallOptions_TimeoutAndRetry(t *testing.T) {
+	var calls int32
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			if deadline, _ := ctx.Deadline(); time.Until(deadline) > time.Second {
+				return NewError(400, "call timeout not used", nil)
+			}
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return ErrShutdown
+			}
+			return NewError(500, "answered", nil)
+		},
+		Context: context.Background(),
+		Timeout: time.Minute,
+	}
+	client := &retriedClient{}
+	f.Inject("svc", client)
+	if _, err := client.Get(WithCallTimeout(time.Second)); err != ErrShutdown || calls != 1 {
+		t.Log(err, calls)
+		t.Fail()
+	}
+	atomic.StoreInt32(&calls, 0)
+	_, err := client.Get(WithCallTimeout(time.Second), WithRetry(5))
+	if rpcErr, ok := err.(*Error); !ok || rpcErr.Code != 500 || calls != 3 {
+		t.Log(err, calls)
+		t.Fail()
+	}
+}
+
+type countingCallerForTest struct {
+	calls int32
+}
+
+func (c *countingCallerForTest) Call(serviceMethod string, args []interface{}, reply interface{}) error {
+	atomic.AddInt32(&c.calls, 1)
+	return nil
+}
+
+func TestPoolSender_RoutingKey(t *testing.T) {
+	var lock sync.Mutex
+	var created []*countingCallerForTest
+	pool := NewFixedPool(4, func(ctx context.Context) (Caller, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		c := &countingCallerForTest{}
+		created = append(created, c)
+		return c, nil
+	})
+	defer pool.Close()
+	ctx := withCallOptions(context.Background(), &callOptions{routingKey: "user-1"})
+	for i := 0; i < 10; i++ {
+		pool.Send("m", ctx, nil, nil)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(created) != 1 || atomic.LoadInt32(&created[0].calls) != 10 {
+		t.Log("connections:", len(created))
+		t.Fail()
+	}
+}
+
+func TestCallOptions_ByName(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+	received := make(chan json.RawMessage, 1)
+	go func() {
+		var req struct {
+			Params json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(serverConn).Decode(&req)
+		received <- req.Params
+	}()
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+	}
+	params := struct {
+		Address string `json:"address"`
+	}{"0x1"}
+	go f.Call(context.Background(), "eth_getBalance", []interface{}{params}, nil, ByName(), AsNotification())
+	if raw := <-received; string(raw) != `{"address":"0x1"}` {
+		t.Log(string(raw))
+		t.Fail()
+	}
+	if err := f.Call(context.Background(), "eth_getBalance", []interface{}{1, 2}, nil, ByName()); err == nil {
+		t.Log("two params sent by name")
+		t.Fail()
+	}
+}
+
+func TestCallOptions_RetryAfterWrite(t *testing.T) {
+	var received int32
+	f := &Factory{
+		// every call gets a connection which is dropped once the request is read
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			serverConn, clientConn := net.Pipe()
+			go func() {
+				var req json.RawMessage
+				json.NewDecoder(serverConn).Decode(&req)
+				atomic.AddInt32(&received, 1)
+				serverConn.Close()
+			}()
+			conn := NewClientConn(clientConn)
+			defer conn.Close()
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	}
+	if err := f.Call(nil, "svc.Get", nil, nil, WithRetry(2)); err != ErrShutdown || atomic.LoadInt32(&received) != 1 {
+		t.Log("a written request was retried:", err, received)
+		t.Fail()
+	}
+	atomic.StoreInt32(&received, 0)
+	if err := f.Call(nil, "svc.Get", nil, nil, WithRetry(2), Idempotent()); err != ErrShutdown || atomic.LoadInt32(&received) != 3 {
+		t.Log("an idempotent call was not retried:", err, received)
+		t.Fail()
+	}
+}
@@ -48,3 +48,12 @@ func (c *LateInitCaller) Clear(version uint64) {
 	}
 	c.client.Store(emptyVersionedCaller)
 }
+
+// current returns the created caller without creating one
+func (c *LateInitCaller) current() (VersionedCaller, bool) {
+	client := c.client.Load()
+	if client == nil || client == emptyVersionedCaller {
+		return emptyVersionedCaller, false
+	}
+	return client.(VersionedCaller), true
+}
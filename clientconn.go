@@ -3,33 +3,37 @@ package jsonrpc
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// callback is buffered so a response for an abandoned call never blocks the reader
 type callback chan responseAndError
 
+// callbacks delivers each response to the func added for its id
 type callbacks struct {
-	store map[uint64]callback
+	store map[uint64]func(responseAndError)
 	mutex sync.Mutex
 }
 
-func (c *callbacks) Add(num uint64) callback {
-	cb := make(callback)
+// AddFunc adds deliver, which runs on the reader goroutine and must not block
+func (c *callbacks) AddFunc(num uint64, deliver func(responseAndError)) {
 	c.mutex.Lock()
-	c.store[num] = cb
+	c.store[num] = deliver
 	c.mutex.Unlock()
-	return cb
 }
 func (c *callbacks) ReleaseAll(err error) {
 	c.mutex.Lock()
-	for _, cb := range c.store {
-		cb <- responseAndError{error: err}
-	}
-	c.store = map[uint64]callback{}
+	store := c.store
+	c.store = map[uint64]func(responseAndError){}
 	c.mutex.Unlock()
+	for _, deliver := range store {
+		deliver(responseAndError{error: err})
+	}
 }
 func (c *callbacks) Del(num uint64) {
 	c.mutex.Lock()
@@ -37,15 +41,16 @@ func (c *callbacks) Del(num uint64) {
 	c.mutex.Unlock()
 }
 func (c *callbacks) Init() {
-	c.store = map[uint64]callback{}
+	c.store = map[uint64]func(responseAndError){}
 }
 func (c *callbacks) Notify(response *response) {
 	c.mutex.Lock()
-	if cb, ok := c.store[response.ID]; ok {
-		delete(c.store, response.ID)
-		cb <- responseAndError{response: response}
-	}
+	deliver, ok := c.store[response.ID]
+	delete(c.store, response.ID)
 	c.mutex.Unlock()
+	if ok {
+		deliver(responseAndError{response: response})
+	}
 }
 
 const (
@@ -65,10 +70,19 @@ type ClientConn struct {
 
 type ClientConnCallerFactory struct {
 	target string
+	// tcp keepalive period, 0 uses the default of net.Dialer and negative disables it
+	KeepAlive time.Duration
+}
+
+func NewClientConnCallerFactory(target string, keepAlive time.Duration) *ClientConnCallerFactory {
+	return &ClientConnCallerFactory{
+		target:    target,
+		KeepAlive: keepAlive,
+	}
 }
 
 func (c *ClientConnCallerFactory) Create(ctx context.Context) (Caller, error) {
-	var d net.Dialer
+	d := net.Dialer{KeepAlive: c.KeepAlive}
 	conn, err := d.DialContext(ctx, "tcp", c.target)
 	if err != nil {
 		return nil, err
@@ -92,31 +106,27 @@ func NewClientConn(conn io.ReadWriteCloser) *ClientConn {
 }
 
 type request struct {
-	Version string        `json:"jsonrpc"`
-	Params  []interface{} `json:"params"`
-	Method  string        `json:"method"`
-	ID      uint64        `json:"id"`
+	Version string `json:"jsonrpc"`
+	// an array, or an object for calls made ByName
+	Params interface{} `json:"params"`
+	Method string      `json:"method"`
+	// 0 is never used as an id, it is left out for notifications
+	ID uint64 `json:"id,omitempty"`
+	// envelope metadata, peers which don't know it ignore it
+	Meta map[string]string `json:"meta,omitempty"`
+	// milliseconds left before the deadline of the caller
+	Timeout int64 `json:"timeout,omitempty"`
 }
-type responseErrorCode int
-type responseError struct {
-	Code    responseErrorCode `json:"code"`
-	Data    interface{}       `json:"data"`
-	Message string            `json:"message"`
-}
-
-func (r *responseError) Error() string {
-	return r.Message
-}
-
 type responseAndError struct {
 	*response
 	error
 }
 type response struct {
-	Version string          `json:"jsonrpc"`
-	Result  json.RawMessage `json:"result"`
-	Error   *responseError  `json:"error"`
-	ID      uint64          `json:"id"`
+	Version string            `json:"jsonrpc"`
+	Result  json.RawMessage   `json:"result"`
+	Error   *Error            `json:"error"`
+	ID      uint64            `json:"id"`
+	Meta    map[string]string `json:"meta"`
 }
 
 func (c *ClientConn) receiveResponse() {
@@ -136,43 +146,109 @@ func (c *ClientConn) receiveResponse() {
 	}
 }
 func (c *ClientConn) WriteRequest(serviceMethod string, args []interface{}) (cb callback, err error) {
+	cb = make(callback, 1)
+	_, err = c.writeRequest(context.Background(), serviceMethod, args, func(re responseAndError) { cb <- re })
+	return
+}
+
+// writeRequest sends a request and adds deliver for its response, the id is 0 for notifications
+func (c *ClientConn) writeRequest(ctx context.Context, serviceMethod string, args []interface{}, deliver func(responseAndError)) (id uint64, err error) {
 	if atomic.LoadInt64(&c.closed) == ClientClosed {
-		return nil, ErrShutdown
+		return 0, ErrShutdown
+	}
+	var params interface{} = args
+	if isByName(ctx) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s: %d params by name, want one params object", serviceMethod, len(args))
+		}
+		params = args[0]
 	}
 	c.writerLocker.Lock()
 	defer c.writerLocker.Unlock()
 	if atomic.LoadInt64(&c.closed) == ClientClosed {
-		return nil, ErrShutdown
+		return 0, ErrShutdown
+	}
+	if !isNotification(ctx) {
+		id = atomic.AddUint64(&c.sequence, 1)
+		c.callbacks.AddFunc(id, deliver)
 	}
-	c.request.ID = atomic.AddUint64(&c.sequence, 1)
-	cb = c.callbacks.Add(c.request.ID)
-	c.request.Params = args
+	c.request.ID = id
+	c.request.Params = params
 	c.request.Method = serviceMethod
+	c.request.Meta = requestMeta(ctx)
+	c.request.Timeout = remainingMillis(ctx)
+	markWritten(ctx)
 	err = c.encoder.Encode(c.request)
 	if err != nil {
-		c.callbacks.Del(c.request.ID)
+		if id != 0 {
+			c.callbacks.Del(id)
+		}
 		if _, ok := err.(*net.OpError); err == io.EOF || ok {
 			atomic.StoreInt64(&c.closed, ClientClosed)
 		}
 	}
 	return
 }
+
+// remainingMillis returns the time left before the deadline of ctx, at least 1 when there is one
+func remainingMillis(ctx context.Context) int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	remaining := int64(time.Until(deadline) / time.Millisecond)
+	if remaining < 1 {
+		remaining = 1
+	}
+	return remaining
+}
+
+// Close closes the connection, pending calls get ErrShutdown
+func (c *ClientConn) Close() error {
+	atomic.StoreInt64(&c.closed, ClientClosed)
+	return c.conn.Close()
+}
+
 func (c *ClientConn) Call(serviceMethod string, args []interface{}, reply interface{}) (err error) {
+	return c.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext is like Call but stops waiting for the response when ctx is done
+func (c *ClientConn) CallContext(ctx context.Context, serviceMethod string, args []interface{}, reply interface{}) (err error) {
 	if atomic.LoadInt64(&c.closed) == ClientClosed {
 		return ErrShutdown
 	}
-	cb, err := c.WriteRequest(serviceMethod, args)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cb := make(callback, 1)
+	id, err := c.writeRequest(ctx, serviceMethod, args, func(re responseAndError) { cb <- re })
+	if err != nil || id == 0 {
+		// notifications have no response
 		return err
 	}
-	re := <-cb
+	var re responseAndError
+	select {
+	case re = <-cb:
+	case <-ctx.Done():
+		c.callbacks.Del(id)
+		return ctx.Err()
+	}
+	return readResponse(ctx, re, reply)
+}
+
+// readResponse decodes the result into reply or returns the error of the call
+func readResponse(ctx context.Context, re responseAndError, reply interface{}) error {
 	if re.error != nil {
 		return re.error
 	}
+	receiveTrailer(ctx, re.response.Meta)
 	if re.response.Error != nil {
-		err = re.response.Error
-		return
+		return defaultErrorRegistry.decode(re.response.Error)
+	}
+	if reply == nil {
+		// the result is not wanted
+		return nil
 	}
-	err = json.Unmarshal(re.response.Result, reply)
-	return err
+	return json.Unmarshal(re.response.Result, reply)
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// adapter implements an interface of the source package with func fields for Factory.Inject
+type adapter struct {
+	iface   string
+	name    string
+	methods []*adapterMethod
+}
+
+type adapterMethod struct {
+	name     string
+	doc      string
+	params   []param
+	results  []string
+	variadic bool
+}
+
+// generateAdapters writes the adapters jsonrpc.Implement needs for the named interfaces
+func generateAdapters(dir string, pkgName string, importPath string, names []string) ([]byte, error) {
+	g, err := newSourceGenerator(dir, pkgName, importPath)
+	if err != nil {
+		return nil, err
+	}
+	// context is imported when a method uses it
+	delete(g.imports, "context")
+	specs := map[string]*ast.TypeSpec{}
+	files := map[*ast.TypeSpec]*ast.File{}
+	for _, filename := range g.filenames {
+		file := g.pkg.Files[filename]
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				specs[typeSpec.Name.Name] = typeSpec
+				files[typeSpec] = file
+			}
+		}
+	}
+	var adapters []*adapter
+	for _, name := range names {
+		spec, ok := specs[name]
+		if !ok {
+			return nil, fmt.Errorf("type %s not found in %s", name, dir)
+		}
+		a, err := g.adapter(spec, files[spec])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		adapters = append(adapters, a)
+	}
+	return g.writeAdapters(adapters), nil
+}
+
+func (g *sourceGenerator) adapter(spec *ast.TypeSpec, file *ast.File) (*adapter, error) {
+	iface, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return nil, errors.New("not an interface")
+	}
+	typ, err := g.typeString(spec.Name, file)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(spec.Name.Name)
+	runes[0] = unicode.ToLower(runes[0])
+	a := &adapter{iface: typ, name: string(runes) + "Adapter"}
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, errors.New("embedded interfaces are not supported")
+		}
+		m := &adapterMethod{name: field.Names[0].Name}
+		if field.Doc != nil {
+			m.doc = strings.TrimSpace(field.Doc.Text())
+		}
+		results := flatten(fn.Results)
+		if len(results) == 0 || len(results) > 2 || !isIdent(results[len(results)-1].Type, "error") {
+			return nil, fmt.Errorf("%s: want (result, error) or error results", m.name)
+		}
+		for _, result := range results {
+			resultType, err := g.typeString(result.Type, file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", m.name, err)
+			}
+			m.results = append(m.results, resultType)
+		}
+		for i, p := range flatten(fn.Params) {
+			paramType, err := g.typeString(p.Type, file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", m.name, err)
+			}
+			name := p.name
+			if name == "" || name == "_" || name == "adapter" {
+				name = "arg" + strconv.Itoa(i)
+			}
+			_, m.variadic = p.Type.(*ast.Ellipsis)
+			m.params = append(m.params, param{name: name, typ: paramType})
+		}
+		a.methods = append(a.methods, m)
+	}
+	return a, nil
+}
+
+func (g *sourceGenerator) writeAdapters(adapters []*adapter) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by jsonrpc-gen. DO NOT EDIT.\n\npackage %s\n\n", g.pkgName)
+	writeImports(&buf, g.imports)
+	for _, a := range adapters {
+		fmt.Fprintf(&buf, "\n// %s implements %s with the funcs Factory.Inject sets\n", a.name, a.iface)
+		fmt.Fprintf(&buf, "type %s struct {\n", a.name)
+		for _, m := range a.methods {
+			fmt.Fprintf(&buf, "%sFunc func(%s) %s `rpc:%q`\n", m.name, m.signature(), m.returns(), m.name)
+		}
+		buf.WriteString("}\n")
+		for _, m := range a.methods {
+			buf.WriteString("\n")
+			writeDoc(&buf, m.doc)
+			fmt.Fprintf(&buf, "func (adapter *%s) %s(%s) %s {\n", a.name, m.name, m.signature(), m.returns())
+			args := make([]string, len(m.params))
+			for i, p := range m.params {
+				args[i] = p.name
+			}
+			if m.variadic {
+				args[len(args)-1] += "..."
+			}
+			fmt.Fprintf(&buf, "return adapter.%sFunc(%s)\n}\n", m.name, strings.Join(args, ", "))
+		}
+	}
+	buf.WriteString("\nfunc init() {\n")
+	for _, a := range adapters {
+		fmt.Fprintf(&buf, "jsonrpc.RegisterAdapter(func() %s { return &%s{} })\n", a.iface, a.name)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func (m *adapterMethod) signature() string {
+	params := make([]string, len(m.params))
+	for i, p := range m.params {
+		params[i] = p.name + " " + p.typ
+	}
+	return strings.Join(params, ", ")
+}
+
+func (m *adapterMethod) returns() string {
+	if len(m.results) == 1 {
+		return m.results[0]
+	}
+	return "(" + strings.Join(m.results, ", ") + ")"
+}
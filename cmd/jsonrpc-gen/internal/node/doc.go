@@ -0,0 +1,5 @@
+// Package node holds the code jsonrpc-gen writes for testdata/node.json,
+// its test runs the generated client against the generated server
+package node
+
+//go:generate go run ../.. -openrpc ../../testdata/node.json -pkg node -o node_gen.go
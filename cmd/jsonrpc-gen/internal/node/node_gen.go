@@ -0,0 +1,92 @@
+// Code generated by jsonrpc-gen. DO NOT EDIT.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mengxiaozhu/jsonrpc"
+)
+
+// Address is hex encoded address
+type Address string
+
+type EthGetBalanceParams struct {
+	Address Address         `json:"address"`
+	Block   json.RawMessage `json:"block,omitempty"`
+}
+
+type Peers []PeersItem
+
+type PeersItem struct {
+	Id      string  `json:"id,omitempty"`
+	Latency float64 `json:"latency,omitempty"`
+}
+
+// Client calls the methods of Node API through a jsonrpc.Factory
+type Client struct {
+	Factory *jsonrpc.Factory
+}
+
+// NewClient returns a Client sending through f
+func NewClient(f *jsonrpc.Factory) *Client {
+	return &Client{Factory: f}
+}
+
+// EthGetBalance calls eth_getBalance
+//
+// Returns the balance of the account of given address
+func (c *Client) EthGetBalance(ctx context.Context, address Address, block json.RawMessage, opts ...jsonrpc.CallOption) (string, error) {
+	var result string
+	err := c.Factory.Call(ctx, "eth_getBalance", []interface{}{EthGetBalanceParams{Address: address, Block: block}}, &result, append([]jsonrpc.CallOption{jsonrpc.ByName()}, opts...)...)
+	return result, err
+}
+
+// DebugSetHead calls debug_setHead
+func (c *Client) DebugSetHead(ctx context.Context, type_ *string, labels map[string]float64, opts ...jsonrpc.CallOption) error {
+	params := []interface{}{type_, labels}
+	switch {
+	case labels != nil:
+	case type_ != nil:
+		params = params[:1]
+	default:
+		params = params[:0]
+	}
+	return c.Factory.Call(ctx, "debug_setHead", params, nil, opts...)
+}
+
+// NetPeers calls net_peers
+func (c *Client) NetPeers(ctx context.Context, opts ...jsonrpc.CallOption) (Peers, error) {
+	var result Peers
+	err := c.Factory.Call(ctx, "net_peers", []interface{}{}, &result, opts...)
+	return result, err
+}
+
+// Server is implemented by the server of Node API
+type Server interface {
+	// EthGetBalance calls eth_getBalance
+	//
+	// Returns the balance of the account of given address
+	EthGetBalance(ctx context.Context, address Address, block json.RawMessage) (string, error)
+	// DebugSetHead calls debug_setHead
+	DebugSetHead(ctx context.Context, type_ *string, labels map[string]float64) error
+	// NetPeers calls net_peers
+	NetPeers(ctx context.Context) (Peers, error)
+}
+
+// RegisterServer serves the methods of s with the names of the document
+func RegisterServer(r jsonrpc.Registry, s Server) error {
+	if err := r.RegisterFunc("eth_getBalance", func(ctx context.Context, params EthGetBalanceParams) (string, error) {
+		return s.EthGetBalance(ctx, params.Address, params.Block)
+	}); err != nil {
+		return err
+	}
+	if err := r.RegisterFunc("debug_setHead", s.DebugSetHead); err != nil {
+		return err
+	}
+	if err := r.RegisterFunc("net_peers", s.NetPeers); err != nil {
+		return err
+	}
+	return nil
+}
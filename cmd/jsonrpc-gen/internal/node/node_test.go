@@ -0,0 +1,80 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mengxiaozhu/jsonrpc"
+)
+
+type nodeServer struct {
+	address Address
+	block   json.RawMessage
+	type_   *string
+	labels  map[string]float64
+}
+
+func (n *nodeServer) EthGetBalance(ctx context.Context, address Address, block json.RawMessage) (string, error) {
+	n.address, n.block = address, block
+	return "0x10", nil
+}
+
+func (n *nodeServer) DebugSetHead(ctx context.Context, type_ *string, labels map[string]float64) error {
+	n.type_, n.labels = type_, labels
+	return nil
+}
+
+func (n *nodeServer) NetPeers(ctx context.Context) (Peers, error) {
+	return Peers{{Id: "peer-1", Latency: 1.5}}, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	impl := &nodeServer{}
+	server := jsonrpc.NewServer()
+	if err := RegisterServer(server, impl); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := jsonrpc.NewClientConn(clientConn)
+	defer conn.Close()
+	client := NewClient(&jsonrpc.Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	})
+	ctx := context.Background()
+
+	// by name, without and with the optional block
+	balance, err := client.EthGetBalance(ctx, "0xabc", nil)
+	if err != nil || balance != "0x10" || impl.address != "0xabc" || impl.block != nil {
+		t.Log(balance, err, impl.address, string(impl.block))
+		t.Fail()
+		return
+	}
+	if _, err = client.EthGetBalance(ctx, "0xabc", json.RawMessage(`"latest"`)); err != nil || string(impl.block) != `"latest"` {
+		t.Log(err, string(impl.block))
+		t.Fail()
+	}
+	// by position on the same connection, unset optional params are left out
+	if err = client.DebugSetHead(ctx, nil, nil); err != nil || impl.type_ != nil || impl.labels != nil {
+		t.Log(err, impl.type_, impl.labels)
+		t.Fail()
+	}
+	head := "soft"
+	if err = client.DebugSetHead(ctx, &head, map[string]float64{"a": 1}); err != nil || impl.type_ == nil || *impl.type_ != "soft" || impl.labels["a"] != 1 {
+		t.Log(err, impl.type_, impl.labels)
+		t.Fail()
+	}
+	if peers, err := client.NetPeers(ctx); err != nil || len(peers) != 1 || peers[0].Id != "peer-1" {
+		t.Log(peers, err)
+		t.Fail()
+	}
+}
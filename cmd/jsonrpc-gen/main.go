@@ -0,0 +1,65 @@
+// jsonrpc-gen generates clients for github.com/mengxiaozhu/jsonrpc
+//
+// it reads the services registered with Register in a Go package and writes
+// a struct of func fields for each, ready for Factory.Inject:
+//
+//	jsonrpc-gen -src ./server -o ./server/client_gen.go
+//
+// or it reads an OpenRPC document and writes its types, a client calling
+// through a Factory and a Server interface with RegisterServer:
+//
+//	jsonrpc-gen -openrpc node.json -pkg node -o ./node/node_gen.go
+//
+// or it writes the adapters jsonrpc.Implement needs for interfaces of a Go package:
+//
+//	jsonrpc-gen -src ./api -iface Calculator,Store -o ./api/adapters_gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"strings"
+)
+
+func main() {
+	src := flag.String("src", ".", "directory of the Go package which registers the services")
+	out := flag.String("o", "", "output file, stdout if empty")
+	pkg := flag.String("pkg", "", "package name of the output, the source package if empty")
+	importPath := flag.String("import", "", "import path of the source package, needed when -pkg differs")
+	spec := flag.String("openrpc", "", "OpenRPC document to generate from instead of -src")
+	ifaces := flag.String("iface", "", "comma separated interfaces of -src to write adapters for, instead of clients")
+	flag.Parse()
+
+	var code []byte
+	var err error
+	switch {
+	case *spec != "":
+		code, err = generateFromOpenRPC(*spec, *pkg)
+	case *ifaces != "":
+		code, err = generateAdapters(*src, *pkg, *importPath, strings.Split(*ifaces, ","))
+	default:
+		code, err = generateFromSource(*src, *pkg, *importPath)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "jsonrpc-gen:", err)
+		os.Exit(1)
+	}
+	if err = write(*out, code); err != nil {
+		fmt.Fprintln(os.Stderr, "jsonrpc-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func write(out string, code []byte) error {
+	formatted, err := format.Source(code)
+	if err != nil {
+		return fmt.Errorf("format generated code: %w", err)
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(formatted)
+		return err
+	}
+	return os.WriteFile(out, formatted, 0644)
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// the parts of an OpenRPC document the generator reads
+type openRPCDocument struct {
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	} `json:"info"`
+	Methods    []openRPCMethod `json:"methods"`
+	Components struct {
+		Schemas            map[string]*jsonSchema        `json:"schemas"`
+		ContentDescriptors map[string]*contentDescriptor `json:"contentDescriptors"`
+	} `json:"components"`
+}
+
+type openRPCMethod struct {
+	Name           string               `json:"name"`
+	Summary        string               `json:"summary"`
+	Description    string               `json:"description"`
+	Params         []*contentDescriptor `json:"params"`
+	Result         *contentDescriptor   `json:"result"`
+	ParamStructure string               `json:"paramStructure"`
+}
+
+type contentDescriptor struct {
+	Ref         string      `json:"$ref"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Required    bool        `json:"required"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaType             `json:"type"`
+	Format               string                 `json:"format"`
+	Title                string                 `json:"title"`
+	Description          string                 `json:"description"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Enum                 []interface{}          `json:"enum"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+}
+
+// schemaType is "type" of a schema, a string or a list like ["string", "null"]
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaType{one}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	*t = list
+	return err
+}
+
+// single returns the type without "null" and whether null is allowed
+func (t schemaType) single() (typ string, nullable bool) {
+	for _, one := range t {
+		if one == "null" {
+			nullable = true
+		} else if typ == "" {
+			typ = one
+		} else {
+			// several types can't be one Go type
+			return "", nullable
+		}
+	}
+	return
+}
+
+// openRPCGenerator writes Go types, a client and a server interface for a document
+type openRPCGenerator struct {
+	doc     *openRPCDocument
+	imports map[string]string
+	// declarations of the named types, by name
+	types map[string]string
+}
+
+func generateFromOpenRPC(filename string, pkgName string) ([]byte, error) {
+	if pkgName == "" {
+		return nil, fmt.Errorf("-pkg is needed with -openrpc")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	doc := &openRPCDocument{}
+	if err = json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	g := &openRPCGenerator{
+		doc:     doc,
+		imports: map[string]string{"context": "context", libraryPath: "jsonrpc"},
+		types:   map[string]string{},
+	}
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.declare(exportName(name), doc.Components.Schemas[name])
+	}
+	var methods []*method
+	for _, m := range doc.Methods {
+		methods = append(methods, g.method(m))
+	}
+	return g.write(pkgName, methods), nil
+}
+
+func (g *openRPCGenerator) method(m openRPCMethod) *method {
+	result := &method{name: m.Name, doc: m.Summary}
+	if m.Description != "" {
+		if result.doc != "" {
+			result.doc += "\n\n"
+		}
+		result.doc += m.Description
+	}
+	goName := exportName(m.Name)
+	used := map[string]bool{"ctx": true, "opts": true, "params": true, "result": true, "err": true}
+	for i, p := range m.Params {
+		p = g.resolve(p)
+		name := paramName(p.Name, i)
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		typ := g.goType(goName+exportName(p.Name), p.Schema)
+		if !p.Required {
+			typ = g.nilable(typ)
+		}
+		result.params = append(result.params, param{name: name, typ: typ, docName: p.Name, optional: !p.Required})
+	}
+	if m.ParamStructure == "by-name" {
+		result.paramsType = g.declareParams(goName+"Params", result.params)
+	}
+	if r := g.resolve(m.Result); r != nil && r.Schema != nil {
+		if typ, nullable := r.Schema.Type.single(); typ != "" || !nullable || r.Schema.Ref != "" {
+			result.result = g.goType(goName+"Result", r.Schema)
+		}
+	}
+	return result
+}
+
+// resolve follows a $ref to #/components/contentDescriptors
+func (g *openRPCGenerator) resolve(d *contentDescriptor) *contentDescriptor {
+	if d == nil || d.Ref == "" {
+		return d
+	}
+	if resolved := g.doc.Components.ContentDescriptors[strings.TrimPrefix(d.Ref, "#/components/contentDescriptors/")]; resolved != nil {
+		return resolved
+	}
+	warnf("content descriptor %s not found", d.Ref)
+	return &contentDescriptor{Schema: &jsonSchema{}}
+}
+
+func paramName(name string, i int) string {
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		return "arg" + strconv.Itoa(i)
+	}
+	runes := []rune(exportName(name))
+	runes[0] = unicode.ToLower(runes[0])
+	name = string(runes)
+	if token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
+
+// goType returns the Go type of s, object schemas declare a type named name
+func (g *openRPCGenerator) goType(name string, s *jsonSchema) string {
+	if s == nil {
+		return g.raw()
+	}
+	if s.Ref != "" {
+		return exportName(s.Ref[strings.LastIndex(s.Ref, "/")+1:])
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 || len(s.AllOf) > 0 {
+		return g.raw()
+	}
+	typ, nullable := s.Type.single()
+	var goType string
+	switch typ {
+	case "string":
+		goType = "string"
+		if s.Format == "date-time" {
+			g.imports["time"] = "time"
+			goType = "time.Time"
+		}
+		if len(s.Enum) > 0 {
+			return g.declare(name, s)
+		}
+	case "integer":
+		goType = "int64"
+	case "number":
+		goType = "float64"
+	case "boolean":
+		goType = "bool"
+	case "array":
+		return "[]" + g.goType(name+"Item", s.Items)
+	case "object":
+		if len(s.Properties) > 0 {
+			goType = g.declare(name, s)
+		} else if additional := s.additional(); additional != nil {
+			return "map[string]" + g.goType(name+"Value", additional)
+		} else {
+			return "map[string]" + g.raw()
+		}
+	default:
+		return g.raw()
+	}
+	if nullable {
+		return "*" + goType
+	}
+	return goType
+}
+
+// nilable returns a type which can tell an unset optional param by nil
+func (g *openRPCGenerator) nilable(typ string) string {
+	underlying := typ
+	if declaration := g.types[typ]; declaration != "" {
+		// a declared slice or map is nilable too
+		_, underlying, _ = strings.Cut(declaration, "type "+typ+" ")
+	}
+	for _, prefix := range []string{"*", "[]", "map[", "json.RawMessage"} {
+		if strings.HasPrefix(underlying, prefix) {
+			return typ
+		}
+	}
+	return "*" + typ
+}
+
+// declareParams adds the params object of a method taking params by name, unset optional params are left out
+func (g *openRPCGenerator) declareParams(name string, params []param) string {
+	for _, taken := g.types[name]; taken; _, taken = g.types[name] {
+		name += "_"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s struct {\n", name)
+	for _, p := range params {
+		tag := p.docName
+		if p.optional {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&buf, "%s %s `json:%q`\n", exportName(p.docName), p.typ, tag)
+	}
+	buf.WriteString("}\n")
+	g.types[name] = buf.String()
+	return name
+}
+
+// callParams returns the params of a call to m, statements building them are written to buf
+func (m *method) callParams(buf *bytes.Buffer) string {
+	if m.paramsType != "" {
+		fields := make([]string, 0, len(m.params))
+		for _, p := range m.params {
+			fields = append(fields, exportName(p.docName)+": "+p.name)
+		}
+		return "[]interface{}{" + m.paramsType + "{" + strings.Join(fields, ", ") + "}}"
+	}
+	args := make([]string, 0, len(m.params))
+	for _, p := range m.params {
+		args = append(args, p.name)
+	}
+	params := "[]interface{}{" + strings.Join(args, ", ") + "}"
+	// trailing optional params which are not set are left out
+	first := len(m.params)
+	for first > 0 && m.params[first-1].optional {
+		first--
+	}
+	if first == len(m.params) {
+		return params
+	}
+	fmt.Fprintf(buf, "params := %s\n", params)
+	if first == len(m.params)-1 {
+		fmt.Fprintf(buf, "if %s == nil {\nparams = params[:%d]\n}\n", m.params[first].name, first)
+		return "params"
+	}
+	buf.WriteString("switch {\n")
+	for i := len(m.params) - 1; i >= first; i-- {
+		fmt.Fprintf(buf, "case %s != nil:\n", m.params[i].name)
+		if i < len(m.params)-1 {
+			fmt.Fprintf(buf, "params = params[:%d]\n", i+1)
+		}
+	}
+	fmt.Fprintf(buf, "default:\nparams = params[:%d]\n}\n", first)
+	return "params"
+}
+
+func (g *openRPCGenerator) raw() string {
+	g.imports["encoding/json"] = "json"
+	return "json.RawMessage"
+}
+
+// additional returns the schema of additionalProperties, which may also be a bool
+func (s *jsonSchema) additional() *jsonSchema {
+	if len(s.AdditionalProperties) == 0 || s.AdditionalProperties[0] != '{' {
+		return nil
+	}
+	additional := &jsonSchema{}
+	if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+		return nil
+	}
+	return additional
+}
+
+// declare adds a named type for s and returns its name
+func (g *openRPCGenerator) declare(name string, s *jsonSchema) string {
+	if _, ok := g.types[name]; ok {
+		return name
+	}
+	// placeholder for recursive schemas
+	g.types[name] = ""
+	var buf bytes.Buffer
+	doc := s.Description
+	if doc == "" {
+		doc = s.Title
+	}
+	if doc != "" {
+		writeDoc(&buf, name+" is "+doc)
+	}
+	typ, _ := s.Type.single()
+	switch {
+	case typ == "object" && len(s.Properties) > 0:
+		required := map[string]bool{}
+		for _, property := range s.Required {
+			required[property] = true
+		}
+		properties := make([]string, 0, len(s.Properties))
+		for property := range s.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+		fmt.Fprintf(&buf, "type %s struct {\n", name)
+		for _, property := range properties {
+			schema := s.Properties[property]
+			writeDoc(&buf, schema.Description)
+			tag := property
+			if !required[property] {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&buf, "%s %s `json:%q`\n", exportName(property), g.goType(name+exportName(property), schema), tag)
+		}
+		buf.WriteString("}\n")
+	case typ == "string" && len(s.Enum) > 0:
+		fmt.Fprintf(&buf, "type %s string\n\nconst (\n", name)
+		for _, value := range s.Enum {
+			if value, ok := value.(string); ok {
+				fmt.Fprintf(&buf, "%s%s %s = %q\n", name, exportName(value), name, value)
+			}
+		}
+		buf.WriteString(")\n")
+	default:
+		if typ == "object" {
+			// an object without properties stays a map
+			s = &jsonSchema{Type: schemaType{"object"}, AdditionalProperties: s.AdditionalProperties}
+		}
+		fmt.Fprintf(&buf, "type %s %s\n", name, g.goType(name, s))
+	}
+	g.types[name] = buf.String()
+	return name
+}
+
+func (g *openRPCGenerator) write(pkgName string, methods []*method) []byte {
+	var buf bytes.Buffer
+	title := g.doc.Info.Title
+	if title == "" {
+		title = "the service"
+	}
+	fmt.Fprintf(&buf, "// Code generated by jsonrpc-gen. DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+	writeImports(&buf, g.imports)
+	names := make([]string, 0, len(g.types))
+	for name := range g.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString("\n" + g.types[name])
+	}
+
+	fmt.Fprintf(&buf, "\n// Client calls the methods of %s through a jsonrpc.Factory\n", title)
+	buf.WriteString("type Client struct {\nFactory *jsonrpc.Factory\n}\n\n")
+	buf.WriteString("// NewClient returns a Client sending through f\n")
+	buf.WriteString("func NewClient(f *jsonrpc.Factory) *Client {\nreturn &Client{Factory: f}\n}\n")
+	for _, m := range methods {
+		buf.WriteString("\n")
+		writeDoc(&buf, m.goDoc())
+		fmt.Fprintf(&buf, "func (c *Client) %s(%s) %s {\n", exportName(m.name), m.signature(true), m.results())
+		params := m.callParams(&buf)
+		opts := "opts..."
+		if m.paramsType != "" {
+			opts = "append([]jsonrpc.CallOption{jsonrpc.ByName()}, opts...)..."
+		}
+		if m.result == "" {
+			fmt.Fprintf(&buf, "return c.Factory.Call(ctx, %q, %s, nil, %s)\n}\n", m.name, params, opts)
+			continue
+		}
+		fmt.Fprintf(&buf, "var result %s\nerr := c.Factory.Call(ctx, %q, %s, &result, %s)\nreturn result, err\n}\n", m.result, m.name, params, opts)
+	}
+
+	fmt.Fprintf(&buf, "\n// Server is implemented by the server of %s\n", title)
+	buf.WriteString("type Server interface {\n")
+	for _, m := range methods {
+		writeDoc(&buf, m.goDoc())
+		fmt.Fprintf(&buf, "%s(%s) %s\n", exportName(m.name), m.signature(false), m.results())
+	}
+	buf.WriteString("}\n\n")
+	buf.WriteString("// RegisterServer serves the methods of s with the names of the document\n")
+	buf.WriteString("func RegisterServer(r jsonrpc.Registry, s Server) error {\n")
+	for _, m := range methods {
+		fn := "s." + exportName(m.name)
+		if m.paramsType != "" {
+			// params sent by name arrive as one object
+			args := []string{"ctx"}
+			for _, p := range m.params {
+				args = append(args, "params."+exportName(p.docName))
+			}
+			fn = fmt.Sprintf("func(ctx context.Context, params %s) %s {\nreturn s.%s(%s)\n}", m.paramsType, m.results(), exportName(m.name), strings.Join(args, ", "))
+		}
+		fmt.Fprintf(&buf, "if err := r.RegisterFunc(%q, %s); err != nil {\nreturn err\n}\n", m.name, fn)
+	}
+	buf.WriteString("return nil\n}\n")
+	return buf.Bytes()
+}
+
+// goDoc starts the doc of a method with its Go name
+func (m *method) goDoc() string {
+	doc := exportName(m.name) + " calls " + m.name
+	if m.doc != "" {
+		doc += "\n\n" + m.doc
+	}
+	return doc
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const libraryPath = "github.com/mengxiaozhu/jsonrpc"
+
+var warnf = func(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "jsonrpc-gen: "+format+"\n", args...)
+}
+
+// service is a type registered with Register under name
+type service struct {
+	name     string
+	typeName string
+	pointer  bool
+	methods  []*method
+}
+
+type method struct {
+	name   string
+	doc    string
+	params []param
+	// the type of the result, empty for methods which only return an error
+	result   string
+	variadic bool
+	// the params are sent as an object of this type, for OpenRPC methods taking params by name
+	paramsType string
+}
+
+type param struct {
+	name string
+	typ  string
+	// the name in an OpenRPC document and whether it may be left out
+	docName  string
+	optional bool
+}
+
+// sourceGenerator reads a package and writes clients for the services it registers
+type sourceGenerator struct {
+	fset    *token.FileSet
+	pkg     *ast.Package
+	pkgName string
+	// sorted names of the files of pkg
+	filenames []string
+	// the package name used to qualify local types, empty if the output is in the same package
+	qualifier string
+	// import path to alias, of the packages used by the generated code
+	imports map[string]string
+	methods map[string][]*ast.FuncDecl
+	files   map[*ast.FuncDecl]*ast.File
+}
+
+// newSourceGenerator parses the package in dir, the output package is pkgName
+func newSourceGenerator(dir string, pkgName string, importPath string) (*sourceGenerator, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("found %d packages in %s, want 1", len(pkgs), dir)
+	}
+	g := &sourceGenerator{
+		fset:    fset,
+		pkgName: pkgName,
+		imports: map[string]string{"context": "context", libraryPath: "jsonrpc"},
+		methods: map[string][]*ast.FuncDecl{},
+		files:   map[*ast.FuncDecl]*ast.File{},
+	}
+	for _, p := range pkgs {
+		g.pkg = p
+	}
+	if g.pkgName == "" {
+		g.pkgName = g.pkg.Name
+	}
+	if g.pkgName != g.pkg.Name {
+		if importPath == "" {
+			return nil, errors.New("-import is needed when the output package differs from the source package")
+		}
+		g.qualifier = g.pkg.Name
+		g.imports[importPath] = g.pkg.Name
+	}
+	for filename := range g.pkg.Files {
+		g.filenames = append(g.filenames, filename)
+	}
+	sort.Strings(g.filenames)
+	return g, nil
+}
+
+func generateFromSource(dir string, pkgName string, importPath string) ([]byte, error) {
+	g, err := newSourceGenerator(dir, pkgName, importPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range g.filenames {
+		g.collectMethods(g.pkg.Files[filename])
+	}
+	var services []*service
+	seen := map[string]bool{}
+	for _, filename := range g.filenames {
+		for _, s := range g.findServices(g.pkg.Files[filename]) {
+			if seen[s.name] {
+				continue
+			}
+			seen[s.name] = true
+			services = append(services, s)
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services registered in %s", dir)
+	}
+	for _, s := range services {
+		g.describe(s)
+	}
+	return g.write(services), nil
+}
+
+func (g *sourceGenerator) collectMethods(file *ast.File) {
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || !fn.Name.IsExported() {
+			continue
+		}
+		name, _ := receiverType(fn.Recv.List[0].Type)
+		g.methods[name] = append(g.methods[name], fn)
+		g.files[fn] = file
+	}
+}
+
+func receiverType(expr ast.Expr) (name string, pointer bool) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+		pointer = true
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name, pointer
+	}
+	return "", pointer
+}
+
+// findServices finds calls like table.Register("name", &T{})
+func (g *sourceGenerator) findServices(file *ast.File) (services []*service) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 {
+			return true
+		}
+		var fun string
+		switch f := call.Fun.(type) {
+		case *ast.Ident:
+			fun = f.Name
+		case *ast.SelectorExpr:
+			fun = f.Sel.Name
+		}
+		if fun != "Register" && fun != "RegisterWithOptions" {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		name, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		typeName, pointer, ok := registeredType(call.Args[1])
+		if !ok {
+			warnf("%s: skip %q, the registered type can't be found in this package", g.fset.Position(call.Pos()), name)
+			return true
+		}
+		services = append(services, &service{name: name, typeName: typeName, pointer: pointer})
+		return true
+	})
+	return
+}
+
+// registeredType resolves &T{}, T{}, new(T) and variables assigned from them
+func registeredType(expr ast.Expr) (name string, pointer bool, ok bool) {
+	switch e := expr.(type) {
+	case *ast.UnaryExpr:
+		if lit, isLit := e.X.(*ast.CompositeLit); isLit && e.Op == token.AND {
+			name, _ = receiverType(lit.Type)
+			return name, true, name != ""
+		}
+	case *ast.CompositeLit:
+		name, _ = receiverType(e.Type)
+		return name, false, name != ""
+	case *ast.CallExpr:
+		if ident, isIdent := e.Fun.(*ast.Ident); isIdent && ident.Name == "new" && len(e.Args) == 1 {
+			name, _ = receiverType(e.Args[0])
+			return name, true, name != ""
+		}
+	case *ast.Ident:
+		if e.Obj == nil {
+			return "", false, false
+		}
+		switch decl := e.Obj.Decl.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range decl.Lhs {
+				if ident, isIdent := lhs.(*ast.Ident); isIdent && ident.Name == e.Name && i < len(decl.Rhs) {
+					return registeredType(decl.Rhs[i])
+				}
+			}
+		case *ast.ValueSpec:
+			for i, ident := range decl.Names {
+				if ident.Name != e.Name {
+					continue
+				}
+				if i < len(decl.Values) {
+					return registeredType(decl.Values[i])
+				}
+				if decl.Type != nil {
+					name, pointer = receiverType(decl.Type)
+					return name, pointer, name != ""
+				}
+			}
+		}
+	}
+	return "", false, false
+}
+
+// describe fills the methods of s, methods the server can't serve are skipped
+func (g *sourceGenerator) describe(s *service) {
+	for _, fn := range g.methods[s.typeName] {
+		if _, pointer := receiverType(fn.Recv.List[0].Type); pointer && !s.pointer {
+			continue
+		}
+		m, err := g.method(fn)
+		if err != nil {
+			warnf("%s: skip %s.%s, %s", g.fset.Position(fn.Pos()), s.typeName, fn.Name.Name, err)
+			continue
+		}
+		s.methods = append(s.methods, m)
+	}
+}
+
+func (g *sourceGenerator) method(fn *ast.FuncDecl) (*method, error) {
+	file := g.files[fn]
+	m := &method{name: fn.Name.Name}
+	if fn.Doc != nil {
+		m.doc = strings.TrimSpace(fn.Doc.Text())
+	}
+	results := flatten(fn.Type.Results)
+	if len(results) == 0 || len(results) > 2 || !isIdent(results[len(results)-1].Type, "error") {
+		return nil, errors.New("want (result, error) or error results")
+	}
+	if len(results) == 2 {
+		result, err := g.typeString(results[0].Type, file)
+		if err != nil {
+			return nil, err
+		}
+		m.result = result
+	}
+	params := flatten(fn.Type.Params)
+	if len(params) > 0 && g.isContext(params[0].Type, file) {
+		params = params[1:]
+	}
+	if len(params) > 0 {
+		_, m.variadic = params[len(params)-1].Type.(*ast.Ellipsis)
+	}
+	if len(results) == 1 && !m.variadic && len(params) == 2 {
+		if star, ok := params[1].Type.(*ast.StarExpr); ok {
+			result, err := g.typeString(star.X, file)
+			if err != nil {
+				return nil, err
+			}
+			m.result = result
+			params = params[:1]
+		}
+	}
+	for i, p := range params {
+		switch p.Type.(type) {
+		case *ast.ChanType, *ast.FuncType:
+			return nil, fmt.Errorf("parameter %d can't be decoded from json", i)
+		}
+		if g.isContext(p.Type, file) {
+			return nil, errors.New("context.Context must be the first parameter")
+		}
+		typ, err := g.typeString(p.Type, file)
+		if err != nil {
+			return nil, err
+		}
+		name := p.name
+		if name == "" || name == "_" || name == "ctx" || name == "opts" {
+			name = "arg" + strconv.Itoa(i)
+		}
+		m.params = append(m.params, param{name: name, typ: typ})
+	}
+	return m, nil
+}
+
+type field struct {
+	name string
+	Type ast.Expr
+}
+
+// flatten splits fields like (a, b int) into one field per name
+func flatten(list *ast.FieldList) (fields []field) {
+	if list == nil {
+		return nil
+	}
+	for _, f := range list.List {
+		if len(f.Names) == 0 {
+			fields = append(fields, field{Type: f.Type})
+		}
+		for _, name := range f.Names {
+			fields = append(fields, field{name: name.Name, Type: f.Type})
+		}
+	}
+	return
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+func (g *sourceGenerator) isContext(expr ast.Expr, file *ast.File) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && importPathOf(file, x.Name) == "context"
+}
+
+// importPathOf returns the path of the package imported as alias by file
+func importPathOf(file *ast.File, alias string) string {
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == alias {
+			return importPath
+		}
+	}
+	return ""
+}
+
+// typeString prints a type of the source package as seen from the output package
+func (g *sourceGenerator) typeString(expr ast.Expr, file *ast.File) (string, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if g.qualifier == "" || types.Universe.Lookup(t.Name) != nil {
+			return t.Name, nil
+		}
+		if !t.IsExported() {
+			return "", fmt.Errorf("unexported type %s can't be used outside package %s", t.Name, g.qualifier)
+		}
+		return g.qualifier + "." + t.Name, nil
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		importPath := importPathOf(file, x.Name)
+		if importPath == "" {
+			return "", fmt.Errorf("package %s is not imported", x.Name)
+		}
+		g.imports[importPath] = x.Name
+		return x.Name + "." + t.Sel.Name, nil
+	case *ast.StarExpr:
+		elem, err := g.typeString(t.X, file)
+		return "*" + elem, err
+	case *ast.Ellipsis:
+		elem, err := g.typeString(t.Elt, file)
+		return "..." + elem, err
+	case *ast.ArrayType:
+		elem, err := g.typeString(t.Elt, file)
+		if t.Len == nil {
+			return "[]" + elem, err
+		}
+		if lit, ok := t.Len.(*ast.BasicLit); ok {
+			return "[" + lit.Value + "]" + elem, err
+		}
+	case *ast.MapType:
+		key, err := g.typeString(t.Key, file)
+		if err != nil {
+			return "", err
+		}
+		value, err := g.typeString(t.Value, file)
+		return "map[" + key + "]" + value, err
+	case *ast.InterfaceType:
+		if len(t.Methods.List) == 0 {
+			return "interface{}", nil
+		}
+	case *ast.StructType:
+		if g.qualifier == "" {
+			var buf bytes.Buffer
+			printer.Fprint(&buf, g.fset, t)
+			return buf.String(), nil
+		}
+	}
+	var buf bytes.Buffer
+	printer.Fprint(&buf, g.fset, expr)
+	return "", fmt.Errorf("type %s is not supported", buf.String())
+}
+
+func (g *sourceGenerator) write(services []*service) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by jsonrpc-gen. DO NOT EDIT.\n\npackage %s\n\n", g.pkgName)
+	writeImports(&buf, g.imports)
+	for _, s := range services {
+		client := exportName(s.name) + "Client"
+		fmt.Fprintf(&buf, "\n// %s calls the methods of %s registered as %q\n", client, s.typeName, s.name)
+		fmt.Fprintf(&buf, "type %s struct {\n", client)
+		for _, m := range s.methods {
+			writeDoc(&buf, m.doc)
+			fmt.Fprintf(&buf, "%s func(%s) %s `rpc:%q`\n", m.name, m.signature(true), m.results(), m.name)
+		}
+		fmt.Fprintf(&buf, "}\n\n")
+		fmt.Fprintf(&buf, "// New%s injects a %s calling %q through f\n", client, client, s.name)
+		fmt.Fprintf(&buf, "func New%s(f *jsonrpc.Factory) (*%s, error) {\n", client, client)
+		fmt.Fprintf(&buf, "client := &%s{}\nif err := f.Inject(%q, client); err != nil {\nreturn nil, err\n}\nreturn client, nil\n}\n", client, s.name)
+	}
+	return buf.Bytes()
+}
+
+func writeImports(buf *bytes.Buffer, imports map[string]string) {
+	paths := make([]string, 0, len(imports))
+	for importPath := range imports {
+		paths = append(paths, importPath)
+	}
+	// the standard library first
+	sort.Slice(paths, func(i, j int) bool {
+		if std(paths[i]) != std(paths[j]) {
+			return std(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	buf.WriteString("import (\n")
+	for i, importPath := range paths {
+		if i > 0 && std(paths[i-1]) && !std(importPath) {
+			buf.WriteString("\n")
+		}
+		if alias := imports[importPath]; alias != path.Base(importPath) {
+			fmt.Fprintf(buf, "%s %q\n", alias, importPath)
+		} else {
+			fmt.Fprintf(buf, "%q\n", importPath)
+		}
+	}
+	buf.WriteString(")\n")
+}
+
+func std(importPath string) bool {
+	return !strings.Contains(strings.Split(importPath, "/")[0], ".")
+}
+
+func writeDoc(buf *bytes.Buffer, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			buf.WriteString("//\n")
+			continue
+		}
+		fmt.Fprintf(buf, "// %s\n", line)
+	}
+}
+
+// signature lists the params, callOptions adds a trailing ...jsonrpc.CallOption unless m is variadic
+func (m *method) signature(callOptions bool) string {
+	params := []string{"ctx context.Context"}
+	for _, p := range m.params {
+		params = append(params, p.name+" "+p.typ)
+	}
+	if callOptions && !m.variadic {
+		params = append(params, "opts ...jsonrpc.CallOption")
+	}
+	return strings.Join(params, ", ")
+}
+
+func (m *method) results() string {
+	if m.result == "" {
+		return "error"
+	}
+	return "(" + m.result + ", error)"
+}
+
+// exportName turns a service name like "user-profile" into UserProfile
+func exportName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 || !unicode.IsLetter([]rune(b.String())[0]) {
+		return "Service" + b.String()
+	}
+	return b.String()
+}
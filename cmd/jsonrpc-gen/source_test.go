@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// checkGolden compares the formatted code with the file golden, -update rewrites it
+func checkGolden(t *testing.T, golden string, code []byte) {
+	formatted, err := format.Source(code)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if *update {
+		os.WriteFile(golden, formatted, 0644)
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil || !bytes.Equal(want, formatted) {
+		t.Log(err, "\n"+string(formatted))
+		t.Fail()
+	}
+}
+
+func TestGenerateFromSource(t *testing.T) {
+	var warnings []string
+	warnf = func(format string, args ...interface{}) { warnings = append(warnings, format) }
+	code, err := generateFromSource("testdata/arith", "", "")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	checkGolden(t, "testdata/arith.golden", code)
+	if len(warnings) != 1 {
+		t.Log("warnings:", warnings)
+		t.Fail()
+	}
+}
+
+func TestGenerateFromSource_OtherPackage(t *testing.T) {
+	warnf = func(format string, args ...interface{}) {}
+	if _, err := generateFromSource("testdata/arith", "client", ""); err == nil {
+		t.Log("missing -import accepted")
+		t.Fail()
+	}
+	code, err := generateFromSource("testdata/arith", "client", "example.com/arith")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	checkGolden(t, "testdata/arith-client.golden", code)
+}
+
+func TestGenerateFromOpenRPC(t *testing.T) {
+	warnf = func(format string, args ...interface{}) {}
+	// the node client is built and run against its server in internal/node
+	for spec, golden := range map[string]string{"petstore": "testdata/petstore.golden", "node": "internal/node/node_gen.go"} {
+		code, err := generateFromOpenRPC(filepath.Join("testdata", spec+".json"), spec)
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		checkGolden(t, golden, code)
+	}
+}
+
+func TestGenerateAdapters(t *testing.T) {
+	code, err := generateAdapters("testdata/arith", "", "", []string{"Calculator"})
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	checkGolden(t, "testdata/arith-adapter.golden", code)
+	if _, err := generateAdapters("testdata/arith", "", "", []string{"Pair"}); err == nil {
+		t.Log("struct accepted as an interface")
+		t.Fail()
+	}
+}
@@ -0,0 +1,44 @@
+package arith
+
+import (
+	"context"
+	"time"
+
+	"github.com/mengxiaozhu/jsonrpc"
+)
+
+type Pair struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type Arith struct{}
+
+// Add returns a+b
+func (a *Arith) Add(ctx context.Context, x, y int) (int, error) { return x + y, nil }
+
+// Sum adds all numbers
+func (a *Arith) Sum(numbers ...int) (int, error) { return 0, nil }
+
+func (a *Arith) Divide(pair Pair, reply *float64) error { return nil }
+
+func (a *Arith) Reset() error { return nil }
+
+func (a *Arith) Since(t time.Time) (map[string]time.Duration, error) { return nil, nil }
+
+// not served, the result is missing
+func (a *Arith) Invalid(x int) {}
+
+func (a *Arith) unexported() error { return nil }
+
+type counter struct{}
+
+func (c counter) Next(ctx context.Context) (int64, error) { return 0, nil }
+
+func (c *counter) Pointer() error { return nil }
+
+func Serve(table *jsonrpc.FunctionTable) {
+	arith := &Arith{}
+	table.Register("arith", arith)
+	table.RegisterWithOptions("counter", counter{}, nil)
+}
@@ -0,0 +1,15 @@
+package arith
+
+import (
+	"context"
+
+	"github.com/mengxiaozhu/jsonrpc"
+)
+
+type Calculator interface {
+	// Add returns a+b
+	Add(ctx context.Context, a, b int) (int, error)
+	Sum(numbers ...int) (int, error)
+	Divide(ctx context.Context, adapter Pair, opts ...jsonrpc.CallOption) (float64, error)
+	Reset(context.Context) error
+}
@@ -2,19 +2,41 @@ package jsonrpc
 
 const Version = "2.0"
 const (
-	MethodNotFoundCode  responseErrorCode = -32601
-	ReturnErrorCode     responseErrorCode = -32001
-	PanicErrorCode      responseErrorCode = -32002
-	OverServerLimitCode responseErrorCode = -32003
+	MethodNotFoundCode   ErrorCode = -32601
+	InvalidParamsCode    ErrorCode = -32602
+	ReturnErrorCode      ErrorCode = -32001
+	PanicErrorCode       ErrorCode = -32002
+	OverServerLimitCode  ErrorCode = -32003
+	TimeoutCode          ErrorCode = -32004
+	UnauthenticatedCode  ErrorCode = -32005
+	PermissionDeniedCode ErrorCode = -32006
+	CanceledCode         ErrorCode = -32007
 )
 
 var (
-	MethodNotFoundResponseError = &responseError{
+	MethodNotFoundResponseError = &Error{
 		Code:    MethodNotFoundCode,
 		Message: "Method not found",
 	}
-	OverServerLimitError = &responseError{
+	OverServerLimitError = &Error{
 		Code:    OverServerLimitCode,
 		Message: "Over Server Limit",
 	}
+	TimeoutError = &Error{
+		Code:    TimeoutCode,
+		Message: "Timeout",
+	}
+	UnauthenticatedError = &Error{
+		Code:    UnauthenticatedCode,
+		Message: "Unauthenticated",
+	}
+	PermissionDeniedError = &Error{
+		Code:    PermissionDeniedCode,
+		Message: "Permission denied",
+	}
+	// CanceledError answers a request whose client went away before it ran, the connection usually drops it
+	CanceledError = &Error{
+		Code:    CanceledCode,
+		Message: "Canceled",
+	}
 )
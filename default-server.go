@@ -12,8 +12,20 @@ func Listen(tcpAddr string) error {
 	return DefaultServer.Listen(tcpAddr)
 }
 
-func Register(name string, obj interface{}) {
-	DefaultServer.Register(name, obj)
+func Register(name string, obj interface{}) error {
+	return DefaultServer.Register(name, obj)
+}
+
+func RegisterFunc(method string, fn interface{}) error {
+	return DefaultServer.RegisterFunc(method, fn)
+}
+
+func Unregister(method string) bool {
+	return DefaultServer.Unregister(method)
+}
+
+func UnregisterService(name string) int {
+	return DefaultServer.UnregisterService(name)
 }
 
 func ServeConn(conn io.ReadWriteCloser) {
@@ -0,0 +1,270 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ElasticPoolOptions controls the size of an ElasticPool
+type ElasticPoolOptions struct {
+	PoolOptions
+	// connections kept open even when idle
+	MinConns int
+	// upper bound of open connections, defaults to MinConns or 1
+	MaxConns int
+	// a connection is dialed when every open connection has at least GrowThreshold in-flight calls, defaults to 1
+	GrowThreshold int64
+}
+
+// PoolStats is a snapshot of the state of a pool
+type PoolStats struct {
+	Open     int
+	InFlight int64
+	Waiters  int64
+}
+
+// ElasticPool is a Sender which keeps between MinConns and MaxConns connections,
+// calls go to the connection with the fewest in-flight calls
+type ElasticPool struct {
+	factory CallerFactory
+	options ElasticPoolOptions
+	lock    sync.Mutex
+	conns   []*pooledCaller
+	dialing int
+	next    int
+	closed  bool
+	// closed and replaced whenever conns changes
+	changed chan struct{}
+	waiters int64
+	done    chan struct{}
+}
+
+func NewElasticPool(factory CallerFactory, options ElasticPoolOptions) *ElasticPool {
+	if options.MaxConns < 1 {
+		options.MaxConns = options.MinConns
+		if options.MaxConns < 1 {
+			options.MaxConns = 1
+		}
+	}
+	if options.GrowThreshold < 1 {
+		options.GrowThreshold = 1
+	}
+	p := &ElasticPool{
+		factory: options.PoolOptions.wrap(factory),
+		options: options,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	interval := options.checkInterval()
+	if interval <= 0 {
+		interval = time.Second
+	}
+	go p.check(interval)
+	return p
+}
+
+func (p *ElasticPool) Send(method string, ctx context.Context, v []interface{}, resp interface{}) error {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = callContext(ctx, conn.Caller, method, v, resp)
+	conn.release()
+	if err == ErrShutdown {
+		p.remove(conn)
+	}
+	return err
+}
+
+// Stats returns the current open connections, in-flight calls and calls waiting for a connection
+func (p *ElasticPool) Stats() PoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	stats := PoolStats{Open: len(p.conns), Waiters: atomic.LoadInt64(&p.waiters)}
+	for _, conn := range p.conns {
+		stats.InFlight += atomic.LoadInt64(&conn.inflight)
+	}
+	return stats
+}
+
+// Close stops growing the pool and closes all connections after their in-flight calls
+func (p *ElasticPool) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	close(p.done)
+	p.notify()
+	p.lock.Unlock()
+	for _, conn := range conns {
+		conn.retire()
+	}
+	return nil
+}
+
+// leastLoaded must be called with lock held
+func (p *ElasticPool) leastLoaded() *pooledCaller {
+	var best *pooledCaller
+	var bestLoad int64
+	n := len(p.conns)
+	p.next++
+	for i := 0; i < n; i++ {
+		conn := p.conns[(p.next+i)%n]
+		load := atomic.LoadInt64(&conn.inflight)
+		if best == nil || load < bestLoad {
+			best, bestLoad = conn, load
+		}
+	}
+	return best
+}
+
+// notify must be called with lock held
+func (p *ElasticPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// acquire returns a connection with its in-flight count already increased
+func (p *ElasticPool) acquire(ctx context.Context) (*pooledCaller, error) {
+	for {
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			return nil, ErrShutdown
+		}
+		if hash, ok := routingHash(ctx); ok && len(p.conns) > 0 {
+			// a routing key keeps to its connection even when it is busy
+			conn := p.conns[hash%uint64(len(p.conns))]
+			atomic.AddInt64(&conn.inflight, 1)
+			p.lock.Unlock()
+			return conn, nil
+		}
+		best := p.leastLoaded()
+		if best != nil && (atomic.LoadInt64(&best.inflight) < p.options.GrowThreshold ||
+			len(p.conns)+p.dialing >= p.options.MaxConns) {
+			atomic.AddInt64(&best.inflight, 1)
+			p.lock.Unlock()
+			return best, nil
+		}
+		if len(p.conns)+p.dialing < p.options.MaxConns {
+			p.dialing++
+			p.lock.Unlock()
+			conn, err := p.dial(ctx)
+			if err != nil {
+				if best == nil {
+					return nil, err
+				}
+				atomic.AddInt64(&best.inflight, 1)
+				return best, nil
+			}
+			atomic.AddInt64(&conn.inflight, 1)
+			return conn, nil
+		}
+		// no connection yet and all dials are in progress
+		changed := p.changed
+		p.lock.Unlock()
+		atomic.AddInt64(&p.waiters, 1)
+		select {
+		case <-changed:
+			atomic.AddInt64(&p.waiters, -1)
+		case <-ctx.Done():
+			atomic.AddInt64(&p.waiters, -1)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dial must be called after increasing dialing
+func (p *ElasticPool) dial(ctx context.Context) (*pooledCaller, error) {
+	atomic.AddInt64(&p.waiters, 1)
+	caller, err := p.factory(ctx)
+	atomic.AddInt64(&p.waiters, -1)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dialing--
+	if err != nil {
+		p.notify()
+		return nil, err
+	}
+	conn := caller.(*pooledCaller)
+	if p.closed {
+		conn.retire()
+		return nil, ErrShutdown
+	}
+	p.conns = append(p.conns, conn)
+	p.notify()
+	return conn, nil
+}
+
+func (p *ElasticPool) remove(conn *pooledCaller) {
+	p.lock.Lock()
+	for i, c := range p.conns {
+		if c == conn {
+			p.conns = append(p.conns[:i:i], p.conns[i+1:]...)
+			p.notify()
+			break
+		}
+	}
+	p.lock.Unlock()
+	conn.retire()
+}
+
+func (p *ElasticPool) check(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.shrink(now)
+			p.fill(interval)
+		}
+	}
+}
+
+// shrink retires connections past their lifetime, and idle ones above MinConns
+func (p *ElasticPool) shrink(now time.Time) {
+	var retired []*pooledCaller
+	p.lock.Lock()
+	kept := p.conns[:0:0]
+	for _, conn := range p.conns {
+		expired := p.options.MaxLifetime > 0 && now.Sub(conn.created) >= p.options.MaxLifetime
+		if !expired && len(p.conns)-len(retired) > p.options.MinConns {
+			expired = p.options.expired(conn, now)
+		}
+		if expired {
+			retired = append(retired, conn)
+		} else {
+			kept = append(kept, conn)
+		}
+	}
+	if len(retired) > 0 {
+		p.conns = kept
+		p.notify()
+	}
+	p.lock.Unlock()
+	for _, conn := range retired {
+		conn.retire()
+	}
+}
+
+// fill dials one connection if the pool is below MinConns
+func (p *ElasticPool) fill(timeout time.Duration) {
+	p.lock.Lock()
+	if p.closed || len(p.conns)+p.dialing >= p.options.MinConns {
+		p.lock.Unlock()
+		return
+	}
+	p.dialing++
+	p.lock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	p.dial(ctx)
+}
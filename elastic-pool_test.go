@@ -0,0 +1,71 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestElasticPool_Grow(t *testing.T) {
+	block := make(chan struct{})
+	pool := NewElasticPool(func(ctx context.Context) (Caller, error) {
+		return &closableCallerForTest{block: block}, nil
+	}, ElasticPoolOptions{MaxConns: 3, GrowThreshold: 1})
+	defer pool.Close()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.Send("m", context.Background(), nil, nil); err != nil {
+				t.Log(err)
+				t.Fail()
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	stats := pool.Stats()
+	if stats.Open != 3 || stats.InFlight != 5 {
+		t.Log("stats:", stats)
+		t.Fail()
+	}
+	close(block)
+	wg.Wait()
+	if stats = pool.Stats(); stats.InFlight != 0 {
+		t.Log("stats:", stats)
+		t.Fail()
+	}
+}
+
+func TestElasticPool_Shrink(t *testing.T) {
+	block := make(chan struct{})
+	pool := NewElasticPool(func(ctx context.Context) (Caller, error) {
+		return &closableCallerForTest{block: block}, nil
+	}, ElasticPoolOptions{
+		PoolOptions: PoolOptions{IdleTimeout: 30 * time.Millisecond},
+		MinConns:    1,
+		MaxConns:    2,
+	})
+	defer pool.Close()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Send("m", context.Background(), nil, nil)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := pool.Stats(); stats.Open != 2 {
+		t.Log("stats:", stats)
+		t.Fail()
+	}
+	close(block)
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+	if stats := pool.Stats(); stats.Open != 1 {
+		t.Log("stats:", stats)
+		t.Fail()
+	}
+}
@@ -1,8 +1,133 @@
 package jsonrpc
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrShutdown                            = errors.New("connection may be shutdown")
 	ErrorInjectObjectMustBePointerOfStruct = errors.New("inject object must be pointer of struct")
+	ErrUnauthenticated                     = errors.New("unauthenticated")
+	ErrNoMethods                           = errors.New("no methods to register")
 )
+
+type SkippedMethod struct {
+	Name   string
+	Reason string
+}
+
+// SkippedMethodsError reports the methods Register couldn't serve
+type SkippedMethodsError struct {
+	Service string
+	Skipped []SkippedMethod
+}
+
+func (e *SkippedMethodsError) Error() string {
+	reasons := make([]string, len(e.Skipped))
+	for i, skipped := range e.Skipped {
+		reasons[i] = e.Service + "." + skipped.Name + ": " + skipped.Reason
+	}
+	return "skipped methods: " + strings.Join(reasons, "; ")
+}
+
+type InvalidField struct {
+	Name   string
+	Reason string
+}
+
+// InvalidFieldsError reports the func fields Inject can't make callable
+type InvalidFieldsError struct {
+	Struct  string
+	Invalid []InvalidField
+}
+
+func (e *InvalidFieldsError) Error() string {
+	reasons := make([]string, len(e.Invalid))
+	for i, invalid := range e.Invalid {
+		reasons[i] = e.Struct + "." + invalid.Name + ": " + invalid.Reason
+	}
+	return "invalid fields: " + strings.Join(reasons, "; ")
+}
+
+type ErrorCode int
+
+// Error is the error object of a response, handlers return it to choose the code, message and data,
+// and callers get it back from failed calls
+type Error struct {
+	Code    ErrorCode   `json:"code"`
+	Data    interface{} `json:"data"`
+	Message string      `json:"message"`
+
+	rawData json.RawMessage
+}
+
+func NewError(code ErrorCode, message string, data interface{}) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
+
+func (r *Error) Error() string {
+	return r.Message
+}
+
+// Is reports whether target is the same *Error or one with the same code and message,
+// so errors.Is(err, TimeoutError) works for a decoded error while generic codes like ReturnErrorCode
+// only match the error they were returned with
+func (r *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && (t == r || t.Code == r.Code && t.Message == r.Message)
+}
+
+func (r *Error) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Code    ErrorCode       `json:"code"`
+		Data    json.RawMessage `json:"data"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	r.Code, r.Message, r.Data, r.rawData = raw.Code, raw.Message, nil, nil
+	if len(raw.Data) > 0 && string(raw.Data) != "null" {
+		r.rawData = raw.Data
+		return json.Unmarshal(raw.Data, &r.Data)
+	}
+	return nil
+}
+
+// DecodeData decodes the data of the error into v
+func (r *Error) DecodeData(v interface{}) error {
+	raw := r.rawData
+	if raw == nil {
+		var err error
+		if raw, err = json.Marshal(r.Data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// CodedError is implemented by errors of handlers which choose the code and data of the response
+type CodedError interface {
+	error
+	ErrorCode() ErrorCode
+	ErrorData() interface{}
+}
+
+// toError converts an error returned by a handler to the error of the response
+func toError(err error) *Error {
+	if registered, ok := defaultErrorRegistry.encode(err); ok {
+		return registered
+	}
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return &Error{Code: coded.ErrorCode(), Message: err.Error(), Data: coded.ErrorData()}
+	}
+	return &Error{Code: ReturnErrorCode, Message: fmt.Sprint(err)}
+}
@@ -0,0 +1,95 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type quotaError struct {
+	Left int
+}
+
+func (q *quotaError) Error() string          { return "quota exceeded" }
+func (q *quotaError) ErrorCode() ErrorCode   { return 429 }
+func (q *quotaError) ErrorData() interface{} { return q }
+
+type failingImpl struct {
+}
+
+func (f *failingImpl) Invalid(field string) (int, error) {
+	return 0, NewError(400, "invalid "+field, map[string]string{"field": field})
+}
+
+func (f *failingImpl) Quota() (int, error) {
+	return 0, &quotaError{Left: 3}
+}
+
+type failingClient struct {
+	Invalid func(field string) (int, error)
+	Quota   func() (int, error)
+}
+
+func TestError_Propagation(t *testing.T) {
+	server := NewServer()
+	server.Register("svc", &failingImpl{})
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	}
+	client := &failingClient{}
+	f.Inject("svc", client)
+
+	_, err := client.Invalid("name")
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != 400 || rpcErr.Message != "invalid name" {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	data := map[string]string{}
+	if err := rpcErr.DecodeData(&data); err != nil || data["field"] != "name" {
+		t.Log(data, err)
+		t.Fail()
+	}
+
+	_, err = client.Quota()
+	quota := &quotaError{}
+	if !errors.As(err, &rpcErr) || rpcErr.Code != 429 || rpcErr.DecodeData(quota) != nil || quota.Left != 3 {
+		t.Log(err)
+		t.Fail()
+	}
+	if errors.Is(err, TimeoutError) || !errors.Is(err, NewError(429, "quota exceeded", nil)) {
+		t.Fail()
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	decoded := &Error{}
+	if err := decoded.UnmarshalJSON([]byte(`{"code":-32004,"message":"Timeout"}`)); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if !errors.Is(decoded, TimeoutError) {
+		t.Log("decoded timeout does not match TimeoutError")
+		t.Fail()
+	}
+	generic := NewError(ReturnErrorCode, "no such user", nil)
+	if errors.Is(generic, &Error{Code: ReturnErrorCode}) || errors.Is(generic, NewError(ReturnErrorCode, "out of stock", nil)) {
+		t.Log("generic error matches another message")
+		t.Fail()
+	}
+	if !errors.Is(generic, generic) {
+		t.Fail()
+	}
+}
@@ -0,0 +1,113 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// errorRegistry maps Go error types to a name carried in the error data, so callers get back
+// an error of the same type the handler returned
+type errorRegistry struct {
+	lock   sync.RWMutex
+	byName map[string]*registeredError
+	byType map[reflect.Type]*registeredError
+}
+
+type registeredError struct {
+	name string
+	code ErrorCode
+	typ  reflect.Type
+}
+
+// errorData is the data of a registered error on the wire
+type errorData struct {
+	Type   string          `json:"type"`
+	Detail json.RawMessage `json:"detail"`
+}
+
+// defaultErrorRegistry is used by servers and clients of this package
+var defaultErrorRegistry = newErrorRegistry()
+
+func newErrorRegistry() *errorRegistry {
+	return &errorRegistry{
+		byName: map[string]*registeredError{},
+		byType: map[reflect.Type]*registeredError{},
+	}
+}
+
+// RegisterError makes errors of the type of prototype travel with name and code, their exported fields are sent as json,
+// both ends must register the type with the same name. Errors rebuilt from values of comparable types
+// match errors.Is with an equal value, pointer types need an Is method for that
+func RegisterError(name string, code ErrorCode, prototype error) {
+	defaultErrorRegistry.register(name, code, prototype)
+}
+
+func (r *errorRegistry) register(name string, code ErrorCode, prototype error) {
+	if code == 0 {
+		code = ReturnErrorCode
+	}
+	e := &registeredError{name: name, code: code, typ: reflect.TypeOf(prototype)}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// registering a name again replaces its type
+	if old, ok := r.byName[name]; ok && r.byType[old.typ] == old {
+		delete(r.byType, old.typ)
+	}
+	if old, ok := r.byType[e.typ]; ok && r.byName[old.name] == old {
+		delete(r.byName, old.name)
+	}
+	r.byName[name] = e
+	r.byType[e.typ] = e
+}
+
+// encode returns the response error of err if its chain holds a registered type
+func (r *errorRegistry) encode(err error) (*Error, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		registered, ok := r.byType[reflect.TypeOf(e)]
+		if !ok {
+			continue
+		}
+		detail, marshalErr := json.Marshal(e)
+		if marshalErr != nil {
+			return nil, false
+		}
+		return &Error{
+			Code:    registered.code,
+			Message: err.Error(),
+			Data:    errorData{Type: registered.name, Detail: detail},
+		}, true
+	}
+	return nil, false
+}
+
+// decode rebuilds the registered error type named in the data of a response error,
+// or returns the response error itself
+func (r *errorRegistry) decode(respErr *Error) error {
+	var data errorData
+	if respErr.DecodeData(&data) != nil || data.Type == "" || data.Detail == nil {
+		return respErr
+	}
+	r.lock.RLock()
+	registered := r.byName[data.Type]
+	r.lock.RUnlock()
+	if registered == nil {
+		return respErr
+	}
+	typ := registered.typ
+	if typ.Kind() == reflect.Ptr {
+		value := reflect.New(typ.Elem())
+		if json.Unmarshal(data.Detail, value.Interface()) != nil {
+			return respErr
+		}
+		return value.Interface().(error)
+	}
+	value := reflect.New(typ)
+	if json.Unmarshal(data.Detail, value.Interface()) != nil {
+		return respErr
+	}
+	return value.Elem().Interface().(error)
+}
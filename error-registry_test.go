@@ -0,0 +1,99 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+type notFoundError struct {
+	Kind string
+	ID   int
+}
+
+func (e notFoundError) Error() string { return fmt.Sprintf("%s %d not found", e.Kind, e.ID) }
+
+type conflictError struct {
+	Version int
+}
+
+func (e *conflictError) Error() string { return "conflict" }
+
+type registryImpl struct {
+}
+
+func (r *registryImpl) Get(id int) (string, error) {
+	return "", fmt.Errorf("get: %w", notFoundError{Kind: "user", ID: id})
+}
+
+func (r *registryImpl) Put(id int) (string, error) {
+	return "", &conflictError{Version: 7}
+}
+
+type registryClient struct {
+	Get func(id int) (string, error)
+	Put func(id int) (string, error)
+}
+
+// withErrorRegistry gives a test its own registry and restores the default one after it
+func withErrorRegistry(t *testing.T) {
+	saved := defaultErrorRegistry
+	defaultErrorRegistry = newErrorRegistry()
+	t.Cleanup(func() { defaultErrorRegistry = saved })
+}
+
+func TestErrorRegistry(t *testing.T) {
+	withErrorRegistry(t)
+	RegisterError("test.NotFound", 404, notFoundError{})
+	RegisterError("test.Conflict", 409, &conflictError{})
+	server := NewServer()
+	server.Register("svc", &registryImpl{})
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			return conn.CallContext(ctx, name, input, output)
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	}
+	client := &registryClient{}
+	f.Inject("svc", client)
+
+	_, err := client.Get(3)
+	if !errors.Is(err, notFoundError{Kind: "user", ID: 3}) {
+		t.Logf("%T %v", err, err)
+		t.Fail()
+	}
+	_, err = client.Put(3)
+	var conflict *conflictError
+	if !errors.As(err, &conflict) || conflict.Version != 7 {
+		t.Logf("%T %v", err, err)
+		t.Fail()
+	}
+}
+
+func TestErrorRegistry_Decode(t *testing.T) {
+	withErrorRegistry(t)
+	RegisterError("test.NotFound", 404, notFoundError{})
+	RegisterError("test.NotFound", 404, notFoundError{})
+	RegisterError("test.Conflict", 404, &conflictError{})
+
+	// data without a registered name stays a response error
+	unnamed := &Error{Code: 404, rawData: []byte(`{"Kind":"user","ID":3}`)}
+	if err := defaultErrorRegistry.decode(unnamed); err != unnamed {
+		t.Logf("%T %v", err, err)
+		t.Fail()
+	}
+	// a type registered twice is still found by name
+	named := &Error{Code: 404, rawData: []byte(`{"type":"test.NotFound","detail":{"Kind":"user","ID":3}}`)}
+	if err := defaultErrorRegistry.decode(named); !errors.Is(err, notFoundError{Kind: "user", ID: 3}) {
+		t.Logf("%T %v", err, err)
+		t.Fail()
+	}
+}
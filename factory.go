@@ -2,22 +2,25 @@ package jsonrpc
 
 import (
 	"context"
-	"net"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
 func NewFactory(target string, poolsize int) *Factory {
 	factory := &Factory{}
-	factory.Sender = NewFixedPool(poolsize, func(ctx context.Context) (Caller, error) {
-		var d net.Dialer
-		conn, err := d.DialContext(ctx, "tcp", target)
-		if err != nil {
-			return nil, err
-		}
-		return NewClientConn(conn), nil
+	factory.Sender = NewFixedPool(poolsize, NewClientConnCallerFactory(target, 0).Create).Send
+	factory.Context = context.Background()
+	factory.Timeout = 20 * time.Second
+	return factory
+}
 
-	}).Send
+// NewElasticFactory creates a Factory whose connections are managed by an ElasticPool
+func NewElasticFactory(target string, options ElasticPoolOptions) *Factory {
+	factory := &Factory{}
+	factory.Sender = NewElasticPool(NewClientConnCallerFactory(target, 0).Create, options).Send
 	factory.Context = context.Background()
 	factory.Timeout = 20 * time.Second
 	return factory
@@ -28,65 +31,303 @@ type Factory struct {
 	Sender           Sender
 	Context          context.Context
 	Timeout          time.Duration
+	// hedging of methods tagged idempotent, nil disables it
+	Hedge *HedgePolicy
+	// adds credentials to every call, nil sends none
+	Credentials CredentialProvider
 }
 
+// Inject sets the func fields of the struct obj points to, every field is checked first
+// and nothing is set if one of them can't be called, the error is an *InvalidFieldsError.
+// Struct fields with an rpc tag and embedded structs are injected too, their methods are named like
+// "name.field.method", other fields which are not funcs are left alone
 func (f *Factory) Inject(name string, obj interface{}) error {
 	objVal := reflect.ValueOf(obj)
-	if objVal.Kind() != reflect.Ptr && objVal.Type().Elem().Kind() != reflect.Struct {
+	if objVal.Kind() != reflect.Ptr || objVal.IsNil() || objVal.Elem().Kind() != reflect.Struct {
 		return ErrorInjectObjectMustBePointerOfStruct
 	}
 	structType := objVal.Type().Elem()
-	structValue := objVal.Elem()
+	injector := &injector{factory: f, seen: map[reflect.Type]bool{}}
+	injector.collect(name, structType, nil, "", map[string]string{})
+	if len(injector.invalid) > 0 {
+		return &InvalidFieldsError{Struct: structType.String(), Invalid: injector.invalid}
+	}
+	for _, injection := range injector.injections {
+		v := objVal.Elem()
+		for _, i := range injection.index[:len(injection.index)-1] {
+			v = v.Field(i)
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+				v = v.Elem()
+			}
+		}
+		v.Field(injection.index[len(injection.index)-1]).Set(injection.fn)
+	}
+	return nil
+}
+
+type injection struct {
+	// field indexes from the injected struct
+	index []int
+	fn    reflect.Value
+}
 
-	numField := structType.NumField()
-	for i := 0; i < numField; i++ {
+// injector collects the funcs of a struct before any of them is set
+type injector struct {
+	factory    *Factory
+	injections []injection
+	invalid    []InvalidField
+	// struct types on the current path, so recursive pointers stop
+	seen map[reflect.Type]bool
+}
+
+// collect walks the fields of structType, prefix is the method name so far and path the field names,
+// options of a struct field are the defaults of its funcs
+func (in *injector) collect(prefix string, structType reflect.Type, index []int, path string, options map[string]string) {
+	in.seen[structType] = true
+	defer delete(in.seen, structType)
+	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
-		methodName := field.Tag.Get("rpc")
+		// the exported fields of an embedded struct can be set even if its type is unexported
+		if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		tag, tagged := field.Tag.Lookup("rpc")
+		if tag == "-" {
+			continue
+		}
+		methodName, fieldOptions := parseTag(tag)
 		if methodName == "" {
-			if f.MethodNameMapper != nil {
-				methodName = f.MethodNameMapper(field.Name)
-			} else {
-				methodName = field.Name
+			methodName = field.Name
+			if in.factory.MethodNameMapper != nil {
+				methodName = in.factory.MethodNameMapper(field.Name)
 			}
 		}
-		if structValue.Field(i).CanSet() {
-			if field.Type.Kind() == reflect.Func {
-				structValue.Field(i).Set(f.makeFunc(name, methodName, field.Type))
+		for key, value := range options {
+			if _, ok := fieldOptions[key]; !ok {
+				fieldOptions[key] = value
 			}
 		}
+		fieldIndex := append(append([]int{}, index...), i)
+		fieldPath := path + field.Name
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct {
+			fieldType = fieldType.Elem()
+		}
+		switch {
+		case field.Type.Kind() == reflect.Func:
+			if _, err := checkFuncType(field.Type); err != nil {
+				in.invalid = append(in.invalid, InvalidField{Name: fieldPath, Reason: err.Error()})
+				continue
+			}
+			parsed, err := parseTagOptions(fieldOptions)
+			if err != nil {
+				in.invalid = append(in.invalid, InvalidField{Name: fieldPath, Reason: err.Error()})
+				continue
+			}
+			in.injections = append(in.injections, injection{
+				index: fieldIndex,
+				fn:    in.factory.makeFunc(joinMethodName(prefix, methodName), parsed, field.Type),
+			})
+		case fieldType.Kind() == reflect.Struct && (tagged || field.Anonymous) && !in.seen[fieldType]:
+			// a struct field without a tag may be any value, like an *http.Client, so only tagged ones are services
+			if field.Anonymous && !tagged {
+				// embedded structs add no name
+				in.collect(prefix, fieldType, fieldIndex, fieldPath+".", fieldOptions)
+				continue
+			}
+			in.collect(joinMethodName(prefix, methodName), fieldType, fieldIndex, fieldPath+".", fieldOptions)
+		}
 	}
-	return nil
+}
+
+func joinMethodName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// Call sends the full method name, with the timeout and credentials of f, a nil result discards the result
+func (f *Factory) Call(ctx context.Context, method string, params []interface{}, result interface{}, opts ...CallOption) error {
+	options := callOptions{timeout: f.Timeout}
+	for _, option := range opts {
+		option(&options)
+	}
+	if ctx == nil {
+		ctx = f.Context
+	}
+	ctx = withCallOptions(ctx, &options)
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+	sender := f.Sender
+	if f.Credentials != nil {
+		sender = CredentialsSender(f.Credentials, sender)
+	}
+	return retry(ctx, options.retries, options.idempotent, func(ctx context.Context) error {
+		return sender(method, ctx, params, result)
+	})
+}
+
+// tagOptions are the options of an rpc tag like "add,timeout=2s,notify,idempotent,retry=3"
+type tagOptions struct {
+	// replaces Factory.Timeout
+	timeout time.Duration
+	// retries after connection errors
+	retries int
+	// calls are sent as notifications
+	notify bool
+	// calls may be hedged by Factory.Hedge and retried after the request was written
+	idempotent bool
+}
+
+func parseTagOptions(options map[string]string) (tagOptions, error) {
+	var parsed tagOptions
+	for key, value := range options {
+		var err error
+		switch key {
+		case "timeout":
+			parsed.timeout, err = time.ParseDuration(value)
+			if err == nil && parsed.timeout <= 0 {
+				err = fmt.Errorf("timeout must be positive, got %s", value)
+			}
+		case "retry":
+			parsed.retries, err = strconv.Atoi(value)
+			if err == nil && parsed.retries < 0 {
+				err = fmt.Errorf("retry must not be negative, got %s", value)
+			}
+		case "notify":
+			parsed.notify = true
+		case "idempotent":
+			parsed.idempotent = true
+		default:
+			err = fmt.Errorf("unknown rpc tag option %q", key)
+		}
+		if err != nil {
+			return parsed, err
+		}
+	}
+	return parsed, nil
+}
+
+// parseTag splits an rpc tag like "add,idempotent" into the method name and its options
+func parseTag(tag string) (name string, options map[string]string) {
+	parts := strings.Split(tag, ",")
+	options = map[string]string{}
+	for _, option := range parts[1:] {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		options[key] = value
+	}
+	return strings.TrimSpace(parts[0]), options
 }
 
 type ValidFuncType uint
 
 const (
 	Invalid ValidFuncType = iota
+	// func(args...) (result, error)
 	respWithErrorReturn
+	// func(args...) error, the result is discarded
+	errorOnlyReturn
+	// func(args...) <-chan Result[T], the call runs in the background
+	asyncReturn
 )
 
-func (f *Factory) checkFuncType(fn reflect.Type) ValidFuncType {
-	if fn.NumIn() != 1 || fn.NumOut() != 2 {
-		return Invalid
+// checkFuncType tells if fn can be injected, params may start with a context.Context
+// and end with ...CallOption
+func checkFuncType(fn reflect.Type) (ValidFuncType, error) {
+	valid := Invalid
+	switch {
+	case fn.NumOut() == 2 && fn.Out(1) == emptyErrorType:
+		if !jsonType(fn.Out(0)) {
+			return Invalid, fmt.Errorf("result of type %s can't be decoded from json", fn.Out(0))
+		}
+		valid = respWithErrorReturn
+	case fn.NumOut() == 1 && fn.Out(0) == emptyErrorType:
+		valid = errorOnlyReturn
+	case fn.NumOut() == 1 && fn.Out(0).Kind() == reflect.Chan:
+		result, ok := asyncResultType(fn)
+		if !ok {
+			return Invalid, fmt.Errorf("returns %s, want <-chan Result[T]", fn.Out(0))
+		}
+		if !jsonType(result) {
+			return Invalid, fmt.Errorf("result of type %s can't be decoded from json", result)
+		}
+		valid = asyncReturn
+	default:
+		return Invalid, fmt.Errorf("returns %d values, want (result, error), error or <-chan Result[T]", fn.NumOut())
 	}
-	if fn.Out(1) != reflect.TypeOf((*error)(nil)).Elem() {
-		return Invalid
+	numIn := fn.NumIn()
+	if hasCallOptions(fn) {
+		numIn--
+	}
+	for i := 0; i < numIn; i++ {
+		param := fn.In(i)
+		if fn.IsVariadic() && i == fn.NumIn()-1 {
+			param = param.Elem()
+		}
+		if param == contextType {
+			if i == 0 {
+				continue
+			}
+			return Invalid, fmt.Errorf("context.Context must be the first parameter, found at %d", i)
+		}
+		if !jsonType(param) {
+			return Invalid, fmt.Errorf("parameter %d of type %s can't be encoded as json", i, param)
+		}
 	}
-	return respWithErrorReturn
+	return valid, nil
+}
+
+func hasCallOptions(fn reflect.Type) bool {
+	return fn.IsVariadic() && fn.In(fn.NumIn()-1) == callOptionsType
 }
 
 var emptyErr error
 var emptyErrorType = reflect.TypeOf(&emptyErr).Elem()
 
-func (f *Factory) makeFunc(serviceName string, methodName string, fn reflect.Type) reflect.Value {
-	resultType := fn.Out(0)
-	name := serviceName + "." + methodName
+func (f *Factory) makeFunc(name string, options tagOptions, fn reflect.Type) reflect.Value {
+	// the result of error only funcs is received and dropped
+	resultType := rawMessageType
+	var async reflect.Type
+	if fn.NumOut() == 2 {
+		resultType = fn.Out(0)
+	} else if result, ok := asyncResultType(fn); ok {
+		resultType = result
+		async = fn.Out(0)
+	}
 	fi := &methodInfo{
-		name:       name,
-		resultType: resultType,
-		ctx:        f.Context,
-		Timeout:    f.Timeout,
-		Sender:     f.Sender,
+		name:        name,
+		resultType:  resultType,
+		ctx:         f.Context,
+		Timeout:     f.Timeout,
+		Sender:      f.Sender,
+		variadic:    fn.IsVariadic() && !hasCallOptions(fn),
+		callOptions: hasCallOptions(fn),
+		errorOnly:   fn.NumOut() == 1 && async == nil,
+		async:       async,
+		retries:     options.retries,
+		notify:      options.notify,
+		idempotent:  options.idempotent,
+	}
+	if options.timeout > 0 {
+		fi.Timeout = options.timeout
+	}
+	if f.Credentials != nil {
+		fi.Sender = CredentialsSender(f.Credentials, f.Sender)
+	}
+	if options.idempotent {
+		fi.hedge = f.Hedge
 	}
 	return reflect.MakeFunc(fn, fi.Do)
 }
@@ -97,19 +338,82 @@ type methodInfo struct {
 	ctx        context.Context
 	Sender     Sender
 	Timeout    time.Duration
+	hedge      *HedgePolicy
+	variadic   bool
+	errorOnly  bool
+	// the last arg is ...CallOption
+	callOptions bool
+	retries     int
+	notify      bool
+	idempotent  bool
+	// the <-chan Result[T] returned by async funcs
+	async reflect.Type
 }
 
 func (info *methodInfo) Do(args []reflect.Value) (results []reflect.Value) {
-	ctx, _ := context.WithTimeout(info.ctx, info.Timeout)
-	returnValue := reflect.New(info.resultType)
+	options := callOptions{timeout: info.Timeout, retries: info.retries, notify: info.notify, idempotent: info.idempotent}
+	if info.callOptions {
+		for _, option := range args[len(args)-1].Interface().([]CallOption) {
+			if option != nil {
+				option(&options)
+			}
+		}
+		args = args[:len(args)-1]
+	}
+	callCtx := info.ctx
+	if len(args) > 0 && args[0].Type() == contextType {
+		// a context parameter replaces Factory.Context, so a handler passes its deadline on
+		if c, ok := args[0].Interface().(context.Context); ok && c != nil {
+			callCtx = c
+		}
+		args = args[1:]
+	}
+	ctx, cancel := context.WithTimeout(withCallOptions(callCtx, &options), options.timeout)
 	params := []interface{}{}
-	for _, v := range args {
+	for i, v := range args {
+		if info.variadic && i == len(args)-1 {
+			// variadic args are sent as trailing params
+			for j := 0; j < v.Len(); j++ {
+				params = append(params, v.Index(j).Interface())
+			}
+			break
+		}
 		params = append(params, v.Interface())
 	}
-	err := info.Sender(info.name, ctx, params, returnValue.Interface())
-	if err == nil {
-		return []reflect.Value{returnValue.Elem(), reflect.New(emptyErrorType).Elem()}
-	} else {
-		return []reflect.Value{returnValue.Elem(), reflect.ValueOf(&err).Elem()}
+	if info.async != nil {
+		results := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, info.async.Elem()), 1)
+		go func() {
+			defer cancel()
+			value, err := info.send(ctx, params, options)
+			result := reflect.New(info.async.Elem()).Elem()
+			result.Field(0).Set(value)
+			if err != nil {
+				result.Field(1).Set(reflect.ValueOf(&err).Elem())
+			}
+			results.Send(result)
+		}()
+		return []reflect.Value{results.Convert(info.async)}
+	}
+	defer cancel()
+	value, err := info.send(ctx, params, options)
+	errValue := reflect.New(emptyErrorType).Elem()
+	if err != nil {
+		errValue = reflect.ValueOf(&err).Elem()
+	}
+	if info.errorOnly {
+		return []reflect.Value{errValue}
 	}
+	return []reflect.Value{value, errValue}
+}
+
+// send returns the decoded result, or its zero value with the error
+func (info *methodInfo) send(ctx context.Context, params []interface{}, options callOptions) (reflect.Value, error) {
+	returnValue := reflect.New(info.resultType)
+	err := retry(ctx, options.retries, options.idempotent, func(ctx context.Context) error {
+		if info.hedge != nil && !options.notify {
+			return info.hedge.send(ctx, info.Sender, info.name, params, returnValue)
+		}
+		return info.Sender(info.name, ctx, params, returnValue.Interface())
+	})
+	return returnValue.Elem(), err
 }
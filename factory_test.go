@@ -3,6 +3,9 @@ package jsonrpc
 import (
 	"context"
 	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -91,3 +94,242 @@ func TestFactory_Inject(t *testing.T) {
 		return
 	}
 }
+
+type hedgeStructForTest struct {
+	Slow func(name string) (i int, err error) `rpc:"slow,idempotent"`
+}
+
+func TestFactory_Hedge(t *testing.T) {
+	var calls int64
+	factory := Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			if atomic.AddInt64(&calls, 1) == 1 {
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			*output.(*int) = 1
+			return nil
+		},
+		Timeout: time.Minute,
+		Context: context.Background(),
+		Hedge:   &HedgePolicy{Delay: 10 * time.Millisecond},
+	}
+	hsft := &hedgeStructForTest{}
+	factory.Inject("serv", hsft)
+	start := time.Now()
+	result, err := hsft.Slow("")
+	if err != nil || result != 1 {
+		t.Log(result, err)
+		t.Fail()
+		return
+	}
+	if time.Since(start) > 500*time.Millisecond || atomic.LoadInt64(&calls) != 2 {
+		t.Log("not hedged", time.Since(start), calls)
+		t.Fail()
+	}
+}
+
+type contextStructForTest struct {
+	Get func(ctx context.Context, name string) (i int, err error)
+}
+
+func TestFactory_InjectContext(t *testing.T) {
+	factory := Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			deadline, ok := ctx.Deadline()
+			if !ok || time.Until(deadline) > time.Second || len(input) != 1 {
+				return errors.New("deadline of the context parameter is lost")
+			}
+			return nil
+		},
+		Timeout: time.Minute,
+		Context: context.Background(),
+	}
+	csft := &contextStructForTest{}
+	factory.Inject("serv", csft)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := csft.Get(ctx, ""); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+}
+
+type variadicStructForTest struct {
+	Sum func(ctx context.Context, first int, more ...int) (int, error)
+}
+
+func TestFactory_InjectVariadic(t *testing.T) {
+	var sent []interface{}
+	factory := Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			sent = input
+			return nil
+		},
+		Timeout: time.Minute,
+		Context: context.Background(),
+	}
+	vsft := &variadicStructForTest{}
+	factory.Inject("serv", vsft)
+	vsft.Sum(context.Background(), 1, 2, 3)
+	if len(sent) != 3 || sent[2] != 3 {
+		t.Log("params:", sent)
+		t.Fail()
+	}
+}
+
+func TestFactory_Call(t *testing.T) {
+	factory := Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			if _, ok := ctx.Deadline(); !ok || name != "eth_getBalance" || output != nil {
+				return errors.New("unexpected call")
+			}
+			return nil
+		},
+		Timeout: time.Minute,
+		Context: context.Background(),
+	}
+	if err := factory.Call(context.Background(), "eth_getBalance", []interface{}{"0x0"}, nil); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+}
+
+type shapesStructForTest struct {
+	Ping   func() error
+	Now    func(ctx context.Context) (time.Time, error)
+	Pair   func(a int, b string) (int, error)
+	hidden func()
+}
+
+type invalidStructForTest struct {
+	Valid     func(name string) (int, error)
+	NoError   func(name string) int
+	LateCtx   func(name string, ctx context.Context) error
+	ChanParam func(c chan int) error
+}
+
+func TestFactory_InjectShapes(t *testing.T) {
+	var sent [][]interface{}
+	factory := Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			sent = append(sent, input)
+			if name == "serv.Ping" {
+				return errors.New("pong")
+			}
+			return nil
+		},
+		Timeout: time.Minute,
+		Context: context.Background(),
+	}
+	ssft := &shapesStructForTest{}
+	if err := factory.Inject("serv", ssft); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if err := ssft.Ping(); err == nil || err.Error() != "pong" {
+		t.Log(err)
+		t.Fail()
+	}
+	ssft.Now(context.Background())
+	ssft.Pair(1, "b")
+	if len(sent) != 3 || len(sent[0]) != 0 || len(sent[1]) != 0 || len(sent[2]) != 2 {
+		t.Log("params:", sent)
+		t.Fail()
+	}
+
+	isft := &invalidStructForTest{}
+	err := factory.Inject("serv", isft)
+	invalid, ok := err.(*InvalidFieldsError)
+	if !ok || len(invalid.Invalid) != 3 || isft.Valid != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if err := factory.Inject("serv", *isft); err != ErrorInjectObjectMustBePointerOfStruct {
+		t.Log(err)
+		t.Fail()
+	}
+}
+
+type profileForTest struct {
+	Get func(ctx context.Context, id int) (string, error) `rpc:"get"`
+}
+
+type userServiceForTest struct {
+	Profile  profileForTest `rpc:"profile,timeout=2s"`
+	Settings *struct {
+		Save func(key string) error `rpc:"save,notify,retry=2"`
+	} `rpc:"settings"`
+	embeddedForTest
+	Skipped func() `rpc:"-"`
+	// not services, they have no rpc tag
+	Client *http.Client
+	Log    struct {
+		Printf func(format string, args ...interface{})
+	}
+}
+
+type embeddedForTest struct {
+	Ping func() error `rpc:"ping"`
+}
+
+func TestFactory_InjectNested(t *testing.T) {
+	var lock sync.Mutex
+	calls := map[string]int{}
+	factory := Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			lock.Lock()
+			calls[name]++
+			lock.Unlock()
+			switch name {
+			case "user.profile.get":
+				if deadline, _ := ctx.Deadline(); time.Until(deadline) > 2*time.Second {
+					return errors.New("timeout option not used")
+				}
+			case "user.settings.save":
+				if !isNotification(ctx) {
+					return errors.New("notify option not used")
+				}
+				return ErrShutdown
+			}
+			return nil
+		},
+		Timeout: time.Minute,
+		Context: context.Background(),
+	}
+	service := &userServiceForTest{}
+	if err := factory.Inject("user", service); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if _, err := service.Profile.Get(context.Background(), 1); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if err := service.Settings.Save("k"); err != ErrShutdown || calls["user.settings.save"] != 3 {
+		t.Log(err, calls)
+		t.Fail()
+	}
+	if err := service.Ping(); err != nil || calls["user.ping"] != 1 || service.Skipped != nil {
+		t.Log(err, calls)
+		t.Fail()
+	}
+	if service.Client != nil || service.Log.Printf != nil {
+		t.Log("untagged struct fields were injected")
+		t.Fail()
+	}
+
+	invalid := &struct {
+		Get func() error `rpc:"get,timeout=soon"`
+		Set func() error `rpc:"set,fast"`
+	}{}
+	if err, ok := factory.Inject("user", invalid).(*InvalidFieldsError); !ok || len(err.Invalid) != 2 {
+		t.Log(err)
+		t.Fail()
+	}
+}
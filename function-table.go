@@ -1,48 +1,221 @@
 package jsonrpc
 
-import "reflect"
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
 
 var _ Registry = &FunctionTable{}
 var _ ServerHandler = &FunctionTable{}
 
 type Registry interface {
-	Register(name string, obj interface{})
+	Register(name string, obj interface{}) error
+	RegisterFunc(method string, fn interface{}) error
+	Unregister(method string) bool
+	UnregisterService(name string) int
 	Find(method string) (fn Executor, has bool)
 }
 
 func NewFunctionTable() *FunctionTable {
 	return &FunctionTable{
-		functions:  map[string]FunctionExecutor{},
+		functions:  map[string]*FunctionExecutor{},
+		options:    map[string]MethodOptions{},
 		nameMapper: DefaultNameMapper,
+		info:       OpenRPCInfo{Title: "jsonrpc", Version: "0.0.0"},
 	}
 }
 
+// MethodOptions configures how the server runs a method
+type MethodOptions struct {
+	// the handler context is canceled and a TimeoutError is sent after Timeout, 0 means no limit
+	Timeout time.Duration
+	// Description is shown in the OpenRPC document
+	Description string
+}
+
+// FunctionTable can be changed while serving
 type FunctionTable struct {
-	functions  map[string]FunctionExecutor
+	lock       sync.RWMutex
+	functions  map[string]*FunctionExecutor
+	options    map[string]MethodOptions
 	nameMapper func(string) string
+	info       OpenRPCInfo
+}
+
+// RegisterWithOptions registers obj like Register, options is keyed by the mapped method name without the service name
+func (table *FunctionTable) RegisterWithOptions(name string, obj interface{}, options map[string]MethodOptions) error {
+	err := table.Register(name, obj)
+	for method, option := range options {
+		table.SetMethodOptions(name+"."+method, option)
+	}
+	return err
 }
 
-func (table *FunctionTable) Register(name string, obj interface{}) {
+// SetMethodOptions sets the options of the full method name, like "service.method"
+func (table *FunctionTable) SetMethodOptions(method string, options MethodOptions) {
+	table.lock.Lock()
+	table.options[method] = options
+	table.lock.Unlock()
+}
+
+func (table *FunctionTable) methodOptions(method string) MethodOptions {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	return table.options[method]
+}
+
+// Register serves the exported methods of obj as "name.Method", methods which can't be served are
+// skipped and reported by a *SkippedMethodsError, the others are registered anyway
+func (table *FunctionTable) Register(name string, obj interface{}) error {
 	value := reflect.ValueOf(obj)
 	num := value.NumMethod()
+	if num == 0 {
+		return fmt.Errorf("%w: %s has no exported methods", ErrNoMethods, name)
+	}
+	var skipped []SkippedMethod
+	executors := map[string]*FunctionExecutor{}
 	for i := 0; i < num; i++ {
 		method := value.Type().Method(i)
-		if method.Type.NumOut() == 2 && method.Type.Out(1) == emptyErrorType {
-			table.functions[name+"."+table.nameMapper(method.Name)] = FunctionExecutor(value.Method(i))
+		executor, err := NewFunctionExecutor(value.Method(i))
+		if err != nil {
+			skipped = append(skipped, SkippedMethod{Name: method.Name, Reason: err.Error()})
+			continue
+		}
+		executors[name+"."+table.nameMapper(method.Name)] = executor
+	}
+	table.lock.Lock()
+	for method, executor := range executors {
+		table.functions[method] = executor
+	}
+	table.lock.Unlock()
+	if len(skipped) > 0 {
+		return &SkippedMethodsError{Service: name, Skipped: skipped}
+	}
+	return nil
+}
+
+// RegisterFunc serves fn, a function or closure of any shape Register accepts, as the full method name
+func (table *FunctionTable) RegisterFunc(method string, fn interface{}) error {
+	executor, err := NewFunctionExecutor(reflect.ValueOf(fn))
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	table.lock.Lock()
+	table.functions[method] = executor
+	table.lock.Unlock()
+	return nil
+}
+
+// Unregister stops serving the full method name, requests already running finish
+func (table *FunctionTable) Unregister(method string) bool {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	_, has := table.functions[method]
+	delete(table.functions, method)
+	delete(table.options, method)
+	return has
+}
+
+// UnregisterService stops serving every method of the service name and returns how many were removed
+func (table *FunctionTable) UnregisterService(name string) int {
+	prefix := name + "."
+	removed := 0
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	for method := range table.functions {
+		if strings.HasPrefix(method, prefix) {
+			delete(table.functions, method)
+			removed++
+		}
+	}
+	for method := range table.options {
+		if strings.HasPrefix(method, prefix) {
+			delete(table.options, method)
 		}
 	}
+	return removed
 }
 
 func (table *FunctionTable) Find(method string) (fn Executor, has bool) {
-	fn, has = table.functions[method]
-	return
+	table.lock.RLock()
+	executor, has := table.functions[method]
+	table.lock.RUnlock()
+	if !has {
+		return nil, false
+	}
+	return executor, true
 }
 
 func (table *FunctionTable) Handle(req *ServerRequest, resp ResponseWriter) {
 	fn, ok := table.Find(req.Method)
 	if ok {
+		ctx := req.Context()
+		if err := ctx.Err(); err != nil {
+			// the deadline passed while queued, or the connection is gone, a response is written
+			// anyway since the wrappers of resp release their limits and spans on Write
+			if err == context.DeadlineExceeded {
+				resp.Write(CreateErrorResponse(req.ID, TimeoutError))
+			} else {
+				resp.Write(CreateErrorResponse(req.ID, CanceledError))
+			}
+			return
+		}
+		if timeout := table.methodOptions(req.Method).Timeout; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if _, has := ctx.Deadline(); has {
+			executeWithDeadline(ctx, fn, req, resp)
+			return
+		}
 		fn.Execute(req, resp)
 		return
 	}
 	resp.Write(CreateErrorResponse(req.ID, MethodNotFoundResponseError))
 }
+
+// executeWithDeadline answers with TimeoutError when fn doesn't finish before the deadline of ctx, its late response is dropped
+func executeWithDeadline(ctx context.Context, fn Executor, req *ServerRequest, resp ResponseWriter) {
+	ctx, cancel := context.WithCancel(ctx)
+	writer := &onceWriter{ResponseWriter: resp}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		fn.Execute(req.WithContext(ctx), &deadlineWriter{ResponseWriter: writer, ctx: ctx})
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		writer.Write(CreateErrorResponse(req.ID, TimeoutError))
+	}
+}
+
+// deadlineWriter drops a response written after the deadline, the TimeoutError is sent instead
+type deadlineWriter struct {
+	ResponseWriter
+	ctx context.Context
+}
+
+func (w *deadlineWriter) Write(resp *ServerResponse) {
+	if w.ctx.Err() != context.DeadlineExceeded {
+		w.ResponseWriter.Write(resp)
+	}
+}
+
+// onceWriter writes only the first response
+type onceWriter struct {
+	ResponseWriter
+	once sync.Once
+}
+
+func (w *onceWriter) Write(resp *ServerResponse) {
+	w.once.Do(func() { w.ResponseWriter.Write(resp) })
+}
@@ -0,0 +1,212 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type slowImpl struct {
+	canceled chan error
+}
+
+func (s *slowImpl) Sleep(ctx context.Context) (string, error) {
+	select {
+	case <-time.After(time.Second):
+		return "late", nil
+	case <-ctx.Done():
+		s.canceled <- ctx.Err()
+		return "late", nil
+	}
+}
+
+func TestFunctionTable_Timeout(t *testing.T) {
+	impl := &slowImpl{canceled: make(chan error, 2)}
+	table := NewFunctionTable()
+	table.RegisterWithOptions("svc", impl, map[string]MethodOptions{"Sleep": {Timeout: 20 * time.Millisecond}})
+
+	// the second client deadline is shorter than the method timeout
+	for i, clientTimeout := range []time.Duration{0, 5 * time.Millisecond} {
+		req := &ServerRequest{ID: uint64(i), Method: "svc.Sleep"}
+		if clientTimeout > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+		writer := &syncWriterForTest{}
+		start := time.Now()
+		table.Handle(req, writer)
+		elapsed := time.Since(start)
+		if err := <-impl.canceled; err != context.DeadlineExceeded {
+			t.Log(err)
+			t.Fail()
+		}
+		time.Sleep(10 * time.Millisecond)
+		if ids := writer.errors(); len(ids) != 1 || len(writer.responses) != 1 || writer.responses[0].Error.Code != TimeoutCode {
+			t.Log("responses:", len(writer.responses))
+			t.Fail()
+		}
+		if clientTimeout > 0 && elapsed >= 20*time.Millisecond {
+			t.Log("client timeout not used")
+			t.Fail()
+		}
+	}
+}
+
+func TestFunctionTable_Expired(t *testing.T) {
+	impl := &slowImpl{canceled: make(chan error, 1)}
+	table := NewFunctionTable()
+	table.Register("svc", impl)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	writer := &syncWriterForTest{}
+	table.Handle((&ServerRequest{ID: 1, Method: "svc.Sleep"}).WithContext(ctx), writer)
+	if len(writer.responses) != 1 || writer.responses[0].Error.Code != TimeoutCode {
+		t.Log("expired request not rejected")
+		t.Fail()
+	}
+	select {
+	case <-impl.canceled:
+		t.Log("expired request was run")
+		t.Fail()
+	default:
+	}
+}
+
+func TestFunctionTable_CanceledReleasesLimit(t *testing.T) {
+	impl := &slowImpl{canceled: make(chan error, 1)}
+	table := NewFunctionTable()
+	table.Register("svc", impl)
+	limiter := NewConcurrencyLimiter(1)
+	handler := &LimitHandler{Limiter: limiter, ServerHandler: table}
+	// the client went away while the request was queued
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer := &syncWriterForTest{}
+	handler.Handle((&ServerRequest{ID: 1, Method: "svc.Sleep"}).WithContext(ctx), writer)
+	if len(writer.responses) != 1 || writer.responses[0].Error.Code != CanceledCode {
+		t.Log("canceled request not answered")
+		t.Fail()
+	}
+	if limiter.InFlight() != 0 {
+		t.Log("limit not released:", limiter.InFlight())
+		t.Fail()
+	}
+}
+
+type shapesImpl struct {
+}
+
+func (s *shapesImpl) Reset() error {
+	return nil
+}
+
+func (s *shapesImpl) Half(i int, reply *string) error {
+	*reply = strconv.Itoa(i / 2)
+	return nil
+}
+
+func (s *shapesImpl) Sum(ctx context.Context, base int, more ...int) (int, error) {
+	for _, i := range more {
+		base += i
+	}
+	return base, nil
+}
+
+func (s *shapesImpl) Pair() (int, int) {
+	return 0, 0
+}
+
+func (s *shapesImpl) Stream() (chan int, error) {
+	return nil, nil
+}
+
+func TestFunctionTable_Shapes(t *testing.T) {
+	table := NewFunctionTable()
+	err := table.Register("svc", &shapesImpl{})
+	skipped, ok := err.(*SkippedMethodsError)
+	if !ok || len(skipped.Skipped) != 2 || skipped.Skipped[0].Name != "Pair" || skipped.Skipped[1].Name != "Stream" {
+		t.Log(err)
+		t.Fail()
+	}
+	params := func(raw ...string) (params []json.RawMessage) {
+		for _, r := range raw {
+			params = append(params, json.RawMessage(r))
+		}
+		return
+	}
+	for _, c := range []struct {
+		request *ServerRequest
+		result  interface{}
+	}{
+		{&ServerRequest{Method: "svc.Reset"}, nil},
+		{&ServerRequest{Method: "svc.Half", Params: params("9")}, "4"},
+		{&ServerRequest{Method: "svc.Sum", Params: params("1")}, 1},
+		{&ServerRequest{Method: "svc.Sum", Params: params("1", "2", "3")}, 6},
+	} {
+		writer := &syncWriterForTest{}
+		table.Handle(c.request, writer)
+		if len(writer.responses) != 1 || writer.responses[0].Error != nil || writer.responses[0].Result != c.result {
+			t.Log(c.request.Method, writer.responses[0])
+			t.Fail()
+		}
+	}
+	writer := &syncWriterForTest{}
+	table.Handle(&ServerRequest{Method: "svc.Half", Params: params(`"x"`)}, writer)
+	if writer.responses[0].Error == nil || writer.responses[0].Error.Code != InvalidParamsCode {
+		t.Log("invalid params accepted")
+		t.Fail()
+	}
+}
+
+func TestFunctionTable_RegisterFunc(t *testing.T) {
+	table := NewFunctionTable()
+	offset := 10
+	if err := table.RegisterFunc("calc.add", func(i int) (int, error) { return i + offset, nil }); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if err := table.RegisterFunc("calc.bad", func() int { return 0 }); err == nil {
+		t.Log("bad shape accepted")
+		t.Fail()
+	}
+	table.Register("svc", &shapesImpl{})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			table.Handle(&ServerRequest{Method: "calc.add", Params: []json.RawMessage{json.RawMessage("1")}}, &syncWriterForTest{})
+		}()
+		go func(i int) {
+			defer wg.Done()
+			table.RegisterFunc("calc.f"+strconv.Itoa(i), func() error { return nil })
+		}(i)
+	}
+	wg.Wait()
+
+	writer := &syncWriterForTest{}
+	table.Handle(&ServerRequest{Method: "calc.add", Params: []json.RawMessage{json.RawMessage("1")}}, writer)
+	if writer.responses[0].Result != 11 {
+		t.Fail()
+	}
+	if !table.Unregister("calc.add") || table.Unregister("calc.add") {
+		t.Fail()
+	}
+	if removed := table.UnregisterService("svc"); removed != 3 {
+		t.Log("removed:", removed)
+		t.Fail()
+	}
+	for _, method := range []string{"calc.add", "svc.Reset"} {
+		if _, has := table.Find(method); has {
+			t.Log("still registered:", method)
+			t.Fail()
+		}
+	}
+}
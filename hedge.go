@@ -0,0 +1,158 @@
+package jsonrpc
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	hedgeSamples    = 128
+	hedgeMinSamples = 16
+	hedgeBurst      = 10
+)
+
+// HedgePolicy sends a second call of an idempotent method when the first one
+// has no reply after a delay, the first success wins and the other call is canceled
+type HedgePolicy struct {
+	// delay before hedging, used until enough latencies are observed when Percentile is set
+	Delay time.Duration
+	// hedge after this percentile (0-1) of the observed latency of the method, 0 always uses Delay
+	Percentile float64
+	// hedged calls allowed per call, 0.1 caps the extra load at 10%, 0 means no cap
+	Budget float64
+
+	lock      sync.Mutex
+	tokens    float64
+	latencies map[string]*latencyWindow
+}
+
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+	dirty   bool
+	cached  time.Duration
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	if len(w.samples) < hedgeSamples {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.next] = d
+		w.next = (w.next + 1) % hedgeSamples
+	}
+	w.dirty = true
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	if w.dirty {
+		sorted := append([]time.Duration(nil), w.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		index := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if index < 0 {
+			index = 0
+		}
+		w.cached = sorted[index]
+		w.dirty = false
+	}
+	return w.cached
+}
+
+func (h *HedgePolicy) delay(method string) time.Duration {
+	if h.Percentile <= 0 {
+		return h.Delay
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	w, ok := h.latencies[method]
+	if !ok || len(w.samples) < hedgeMinSamples {
+		return h.Delay
+	}
+	return w.percentile(h.Percentile)
+}
+
+func (h *HedgePolicy) observe(method string, d time.Duration) {
+	if h.Percentile <= 0 {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.latencies == nil {
+		h.latencies = map[string]*latencyWindow{}
+	}
+	w, ok := h.latencies[method]
+	if !ok {
+		w = &latencyWindow{}
+		h.latencies[method] = w
+	}
+	w.add(d)
+}
+
+func (h *HedgePolicy) deposit() {
+	if h.Budget <= 0 {
+		return
+	}
+	h.lock.Lock()
+	h.tokens = math.Min(h.tokens+h.Budget, hedgeBurst)
+	h.lock.Unlock()
+}
+
+func (h *HedgePolicy) withdraw() bool {
+	if h.Budget <= 0 {
+		return true
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+type hedgeResult struct {
+	value reflect.Value
+	err   error
+}
+
+// send calls sender and maybe a hedge, out is a pointer which receives the winning result
+func (h *HedgePolicy) send(ctx context.Context, sender Sender, name string, params []interface{}, out reflect.Value) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, 2)
+	attempt := func() {
+		start := time.Now()
+		value := reflect.New(out.Type().Elem())
+		err := sender(name, ctx, params, value.Interface())
+		if err == nil {
+			h.observe(name, time.Since(start))
+		}
+		results <- hedgeResult{value: value, err: err}
+	}
+	h.deposit()
+	go attempt()
+	pending := 1
+	timer := time.NewTimer(h.delay(name))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if h.withdraw() {
+				pending++
+				go attempt()
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				out.Elem().Set(r.value.Elem())
+				return nil
+			}
+			if pending == 0 {
+				return r.err
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var adapters = struct {
+	lock sync.RWMutex
+	new  map[reflect.Type]func() interface{}
+}{new: map[reflect.Type]func() interface{}{}}
+
+// RegisterAdapter lets Implement build the interface T, newAdapter returns a pointer to a
+// struct of func fields which implements T by calling them, jsonrpc-gen -iface writes both
+func RegisterAdapter[T any](newAdapter func() T) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("jsonrpc: RegisterAdapter of %s, want an interface", typ))
+	}
+	adapters.lock.Lock()
+	adapters.new[typ] = func() interface{} { return newAdapter() }
+	adapters.lock.Unlock()
+}
+
+// Implement returns a T whose methods call service through f, T needs an adapter registered by RegisterAdapter
+func Implement[T any](f *Factory, service string) (T, error) {
+	var implementation T
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	adapters.lock.RLock()
+	newAdapter, ok := adapters.new[typ]
+	adapters.lock.RUnlock()
+	if !ok {
+		return implementation, fmt.Errorf("no adapter registered for %s, generate one with jsonrpc-gen -iface", typ)
+	}
+	adapter := newAdapter()
+	if err := f.Inject(service, adapter); err != nil {
+		return implementation, err
+	}
+	return adapter.(T), nil
+}
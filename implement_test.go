@@ -0,0 +1,67 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type calculatorForTest interface {
+	Add(ctx context.Context, a int, b int) (int, error)
+	Reset(ctx context.Context) error
+}
+
+// written like the adapters of jsonrpc-gen -iface
+type calculatorForTestAdapter struct {
+	AddFunc   func(ctx context.Context, a int, b int) (int, error) `rpc:"Add"`
+	ResetFunc func(ctx context.Context) error                      `rpc:"Reset"`
+}
+
+func (adapter *calculatorForTestAdapter) Add(ctx context.Context, a int, b int) (int, error) {
+	return adapter.AddFunc(ctx, a, b)
+}
+
+func (adapter *calculatorForTestAdapter) Reset(ctx context.Context) error {
+	return adapter.ResetFunc(ctx)
+}
+
+func TestImplement(t *testing.T) {
+	f := &Factory{
+		Sender: func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+			if name != "calc.Add" {
+				return errors.New("unexpected " + name)
+			}
+			*output.(*int) = input[0].(int) + input[1].(int)
+			return nil
+		},
+		Context: context.Background(),
+		Timeout: time.Second,
+	}
+	if _, err := Implement[calculatorForTest](f, "calc"); err == nil {
+		t.Log("implemented without an adapter")
+		t.Fail()
+	}
+	RegisterAdapter(func() calculatorForTest { return &calculatorForTestAdapter{} })
+	// the registry is global, so the next run starts without the adapter again
+	t.Cleanup(func() {
+		adapters.lock.Lock()
+		delete(adapters.new, reflect.TypeOf((*calculatorForTest)(nil)).Elem())
+		adapters.lock.Unlock()
+	})
+	calc, err := Implement[calculatorForTest](f, "calc")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	if sum, err := calc.Add(context.Background(), 1, 2); err != nil || sum != 3 {
+		t.Log(sum, err)
+		t.Fail()
+	}
+	if err := calc.Reset(context.Background()); err == nil || err.Error() != "unexpected calc.Reset" {
+		t.Log(err)
+		t.Fail()
+	}
+}
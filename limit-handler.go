@@ -11,11 +11,15 @@ type LimitHandler struct {
 }
 
 func (l *LimitHandler) Handle(request *ServerRequest, writer ResponseWriter) {
-	if l.Limiter.Allow() {
-		l.ServerHandler.Handle(request, writer)
+	release, retryAfter, ok := acquire(l.Limiter, request)
+	if !ok {
+		writer.Write(CreateErrorResponse(request.ID, overLimitError(retryAfter)))
 		return
 	}
-	writer.Write(CreateErrorResponse(request.ID, OverServerLimitError))
+	if release != nil {
+		writer = &releaseWriter{ResponseWriter: writer, release: release}
+	}
+	l.ServerHandler.Handle(request, writer)
 }
 
 type MethodsLimitHandler struct {
@@ -26,10 +30,14 @@ type MethodsLimitHandler struct {
 func (l *MethodsLimitHandler) Handle(request *ServerRequest, writer ResponseWriter) {
 
 	if limiter, ok := l.Limiters[request.Method]; ok {
-		if !limiter.Allow() {
-			writer.Write(CreateErrorResponse(request.ID, OverServerLimitError))
+		release, retryAfter, ok := acquire(limiter, request)
+		if !ok {
+			writer.Write(CreateErrorResponse(request.ID, overLimitError(retryAfter)))
 			return
 		}
+		if release != nil {
+			writer = &releaseWriter{ResponseWriter: writer, release: release}
+		}
 	}
 
 	l.ServerHandler.Handle(request, writer)
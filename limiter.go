@@ -0,0 +1,284 @@
+package jsonrpc
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// AcquireLimiter is a Limiter which looks at the request and may need to know when it is done,
+// LimitHandler and MethodsLimitHandler prefer Acquire over Allow
+type AcquireLimiter interface {
+	Limiter
+	// Acquire admits request or returns how long the client should wait before retrying,
+	// release is nil or must be called once the request is done
+	Acquire(request *ServerRequest) (release func(), retryAfter time.Duration, ok bool)
+}
+
+// OverLimitData is the data of OverServerLimitError when the limiter knows when to retry
+type OverLimitData struct {
+	RetryAfterMillis int64 `json:"retry_after_ms"`
+}
+
+func overLimitError(retryAfter time.Duration) *Error {
+	if retryAfter <= 0 {
+		return OverServerLimitError
+	}
+	return &Error{
+		Code:    OverServerLimitCode,
+		Message: OverServerLimitError.Message,
+		Data:    OverLimitData{RetryAfterMillis: int64(math.Ceil(float64(retryAfter) / float64(time.Millisecond)))},
+	}
+}
+
+func acquire(limiter Limiter, request *ServerRequest) (release func(), retryAfter time.Duration, ok bool) {
+	if l, is := limiter.(AcquireLimiter); is {
+		return l.Acquire(request)
+	}
+	return nil, 0, limiter.Allow()
+}
+
+// releaseWriter releases a limiter when the response is written
+type releaseWriter struct {
+	ResponseWriter
+	once    sync.Once
+	release func()
+}
+
+func (w *releaseWriter) Write(resp *ServerResponse) {
+	w.once.Do(w.release)
+	w.ResponseWriter.Write(resp)
+}
+
+// TokenBucket allows Rate requests per second with bursts up to Burst
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+func (b *TokenBucket) Allow() bool {
+	_, _, ok := b.Acquire(nil)
+	return ok
+}
+
+func (b *TokenBucket) Acquire(request *ServerRequest) (release func(), retryAfter time.Duration, ok bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return nil, 0, true
+	}
+	if b.rate <= 0 {
+		return nil, 0, false
+	}
+	return nil, time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+// SlidingWindow allows Limit requests in any Window, estimated from the counts of the current and the previous window
+type SlidingWindow struct {
+	limit    int
+	window   time.Duration
+	lock     sync.Mutex
+	start    time.Time
+	previous int
+	current  int
+	now      func() time.Time
+}
+
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+func (w *SlidingWindow) Allow() bool {
+	_, _, ok := w.Acquire(nil)
+	return ok
+}
+
+func (w *SlidingWindow) Acquire(request *ServerRequest) (release func(), retryAfter time.Duration, ok bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := w.now()
+	if w.start.IsZero() {
+		w.start = now
+	}
+	if elapsed := now.Sub(w.start); elapsed >= w.window {
+		windows := int(elapsed / w.window)
+		if windows == 1 {
+			w.previous = w.current
+		} else {
+			w.previous = 0
+		}
+		w.current = 0
+		w.start = w.start.Add(time.Duration(windows) * w.window)
+	}
+	elapsed := now.Sub(w.start)
+	weight := 1 - float64(elapsed)/float64(w.window)
+	if float64(w.previous)*weight+float64(w.current) < float64(w.limit) {
+		w.current++
+		return nil, 0, true
+	}
+	if w.current >= w.limit || w.previous == 0 {
+		return nil, w.window - elapsed, false
+	}
+	// the weight of the previous window has to drop until one more request fits
+	needed := 1 - float64(w.limit-w.current)/float64(w.previous)
+	wait := time.Duration(needed*float64(w.window)) - elapsed
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+	return nil, wait, false
+}
+
+// ConcurrencyLimiter allows at most Max requests in flight
+type ConcurrencyLimiter struct {
+	max      int64
+	lock     sync.Mutex
+	inflight int64
+}
+
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{max: int64(max)}
+}
+
+// Allow reports whether a request would be admitted now, it doesn't take a slot
+func (l *ConcurrencyLimiter) Allow() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.inflight < l.max
+}
+
+func (l *ConcurrencyLimiter) Acquire(request *ServerRequest) (release func(), retryAfter time.Duration, ok bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.inflight >= l.max {
+		return nil, 0, false
+	}
+	l.inflight++
+	return l.release, 0, true
+}
+
+func (l *ConcurrencyLimiter) release() {
+	l.lock.Lock()
+	l.inflight--
+	l.lock.Unlock()
+}
+
+// InFlight returns the requests currently admitted
+func (l *ConcurrencyLimiter) InFlight() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.inflight
+}
+
+// KeyedLimiter gives every key, usually a client, its own limiter
+type KeyedLimiter struct {
+	key        func(request *ServerRequest) string
+	newLimiter func() Limiter
+	// limiters of keys without requests for IdleTTL are dropped
+	IdleTTL  time.Duration
+	lock     sync.Mutex
+	limiters map[string]*keyedEntry
+	swept    time.Time
+}
+
+type keyedEntry struct {
+	limiter  Limiter
+	lastUsed time.Time
+	// requests between Acquire and release, a busy entry is never dropped
+	inflight int
+}
+
+func NewKeyedLimiter(key func(request *ServerRequest) string, newLimiter func() Limiter) *KeyedLimiter {
+	return &KeyedLimiter{
+		key:        key,
+		newLimiter: newLimiter,
+		IdleTTL:    10 * time.Minute,
+		limiters:   map[string]*keyedEntry{},
+	}
+}
+
+// Allow always returns true since there is no key without a request
+func (l *KeyedLimiter) Allow() bool {
+	return true
+}
+
+func (l *KeyedLimiter) Acquire(request *ServerRequest) (release func(), retryAfter time.Duration, ok bool) {
+	key := l.key(request)
+	now := time.Now()
+	l.lock.Lock()
+	if now.Sub(l.swept) >= l.IdleTTL {
+		for k, entry := range l.limiters {
+			if entry.inflight == 0 && now.Sub(entry.lastUsed) >= l.IdleTTL {
+				delete(l.limiters, k)
+			}
+		}
+		l.swept = now
+	}
+	entry, has := l.limiters[key]
+	if !has {
+		entry = &keyedEntry{limiter: l.newLimiter()}
+		l.limiters[key] = entry
+	}
+	entry.lastUsed = now
+	entry.inflight++
+	l.lock.Unlock()
+	inner, retryAfter, ok := acquire(entry.limiter, request)
+	if !ok {
+		l.done(entry)
+		return nil, retryAfter, false
+	}
+	return func() {
+		if inner != nil {
+			inner()
+		}
+		l.done(entry)
+	}, retryAfter, true
+}
+
+func (l *KeyedLimiter) done(entry *keyedEntry) {
+	l.lock.Lock()
+	entry.inflight--
+	entry.lastUsed = time.Now()
+	l.lock.Unlock()
+}
+
+// RemoteIPKey keys requests by the ip of the client
+func RemoteIPKey(request *ServerRequest) string {
+	info, ok := ConnInfoFromContext(request.Context())
+	if !ok || info.RemoteAddr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(info.RemoteAddr.String()); err == nil {
+		return host
+	}
+	return info.RemoteAddr.String()
+}
+
+// ConnKey keys requests by their connection
+func ConnKey(request *ServerRequest) string {
+	info, _ := ConnInfoFromContext(request.Context())
+	return info.key()
+}
@@ -0,0 +1,128 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type clockForTest struct {
+	t time.Time
+}
+
+func (c *clockForTest) now() time.Time {
+	return c.t
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &clockForTest{t: time.Unix(0, 0)}
+	bucket := NewTokenBucket(10, 2)
+	bucket.now = clock.now
+	if !bucket.Allow() || !bucket.Allow() {
+		t.Fail()
+		return
+	}
+	_, retryAfter, ok := bucket.Acquire(nil)
+	if ok || retryAfter != 100*time.Millisecond {
+		t.Log(ok, retryAfter)
+		t.Fail()
+	}
+	clock.t = clock.t.Add(100 * time.Millisecond)
+	if !bucket.Allow() {
+		t.Fail()
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := &clockForTest{t: time.Unix(0, 0)}
+	window := NewSlidingWindow(2, time.Second)
+	window.now = clock.now
+	if !window.Allow() || !window.Allow() || window.Allow() {
+		t.Fail()
+		return
+	}
+	// half of the previous window still counts
+	clock.t = clock.t.Add(1500 * time.Millisecond)
+	if !window.Allow() || window.Allow() {
+		t.Fail()
+	}
+}
+
+type noopHandler struct {
+	written chan struct{}
+}
+
+func (h *noopHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	go func() {
+		<-h.written
+		writer.Write(&ServerResponse{ID: request.ID})
+	}()
+}
+
+func TestLimitHandler_Concurrency(t *testing.T) {
+	inner := &noopHandler{written: make(chan struct{})}
+	limiter := NewConcurrencyLimiter(1)
+	handler := &LimitHandler{Limiter: limiter, ServerHandler: inner}
+	writer := &writerForTest{}
+	handler.Handle(&ServerRequest{ID: 1}, writer)
+	handler.Handle(&ServerRequest{ID: 2}, writer)
+	if len(writer.responses) != 1 || writer.responses[0].Error.Code != OverServerLimitCode {
+		t.Log("second request was not rejected")
+		t.Fail()
+		return
+	}
+	inner.written <- struct{}{}
+	for limiter.InFlight() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if !limiter.Allow() {
+		t.Fail()
+	}
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	limiter := NewKeyedLimiter(ConnKey, func() Limiter { return NewTokenBucket(1, 1) })
+	inner := &noopHandler{written: make(chan struct{})}
+	defer close(inner.written)
+	handler := &MethodsLimitHandler{
+		Limiters:      map[string]Limiter{"svc.m": limiter},
+		ServerHandler: inner,
+	}
+	conn1 := (&ServerRequest{ID: 1, Method: "svc.m"}).WithContext(context.WithValue(context.Background(), connInfoKey{}, ConnInfo{ID: 1}))
+	conn2 := (&ServerRequest{ID: 2, Method: "svc.m"}).WithContext(context.WithValue(context.Background(), connInfoKey{}, ConnInfo{ID: 2}))
+	// admitted requests are answered by their own goroutines, so they get their own writers
+	writer := &writerForTest{}
+	handler.Handle(conn1, &writerForTest{})
+	handler.Handle(conn1, writer)
+	handler.Handle(conn2, &writerForTest{})
+	if len(writer.responses) != 1 || writer.responses[0].ID != 1 {
+		t.Log("only the second request of conn 1 should be rejected")
+		t.Fail()
+		return
+	}
+	if data, ok := writer.responses[0].Error.Data.(OverLimitData); !ok || data.RetryAfterMillis <= 0 {
+		t.Log("no retry after:", writer.responses[0].Error.Data)
+		t.Fail()
+	}
+}
+
+func TestKeyedLimiter_SweepKeepsBusy(t *testing.T) {
+	limiter := NewKeyedLimiter(func(*ServerRequest) string { return "client" }, func() Limiter { return NewConcurrencyLimiter(1) })
+	limiter.IdleTTL = time.Millisecond
+	release, _, ok := limiter.Acquire(&ServerRequest{ID: 1})
+	if !ok {
+		t.Fail()
+		return
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, _, ok = limiter.Acquire(&ServerRequest{ID: 2}); ok {
+		t.Log("the limiter of a busy key was dropped")
+		t.Fail()
+		return
+	}
+	release()
+	if _, _, ok = limiter.Acquire(&ServerRequest{ID: 3}); !ok {
+		t.Log("not admitted after release")
+		t.Fail()
+	}
+}
@@ -0,0 +1,112 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Metadata travels with a call in the "meta" field of the request and the response,
+// peers which don't know the field ignore it
+type Metadata map[string]string
+
+func (md Metadata) Get(key string) string {
+	return md[key]
+}
+
+func (md Metadata) clone() Metadata {
+	c := make(Metadata, len(md))
+	for k, v := range md {
+		c[k] = v
+	}
+	return c
+}
+
+type outgoingMetadataKey struct{}
+type incomingMetadataKey struct{}
+type trailerKey struct{}
+type trailerReceiverKey struct{}
+
+// WithMetadata returns a context whose calls send key and value along with the metadata already in ctx
+func WithMetadata(ctx context.Context, key, value string) context.Context {
+	md, _ := ctx.Value(outgoingMetadataKey{}).(Metadata)
+	md = md.clone()
+	md[key] = value
+	return context.WithValue(ctx, outgoingMetadataKey{}, md)
+}
+
+// OutgoingMetadata returns the metadata calls made with ctx send
+func OutgoingMetadata(ctx context.Context) Metadata {
+	md, _ := ctx.Value(outgoingMetadataKey{}).(Metadata)
+	return md
+}
+
+// MetadataFromContext returns the metadata sent by the client, in the context of a handler
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(incomingMetadataKey{}).(Metadata)
+	return md
+}
+
+// SetTrailer adds metadata to the response of the request handled with ctx
+func SetTrailer(ctx context.Context, key, value string) {
+	if t, ok := ctx.Value(trailerKey{}).(*trailer); ok {
+		t.set(key, value)
+	}
+}
+
+// WithTrailer returns a context whose call stores the metadata of the response in md
+func WithTrailer(ctx context.Context, md *Metadata) context.Context {
+	return context.WithValue(ctx, trailerReceiverKey{}, md)
+}
+
+type trailer struct {
+	lock sync.Mutex
+	md   Metadata
+}
+
+func (t *trailer) set(key, value string) {
+	t.lock.Lock()
+	if t.md == nil {
+		t.md = Metadata{}
+	}
+	t.md[key] = value
+	t.lock.Unlock()
+}
+
+func (t *trailer) get() Metadata {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.md
+}
+
+// requestMeta builds the envelope metadata of a call made with ctx
+func requestMeta(ctx context.Context) map[string]string {
+	md := OutgoingMetadata(ctx)
+	if _, ok := SpanContextFromContext(ctx); ok {
+		md = md.clone()
+	}
+	return injectSpanContext(ctx, md)
+}
+
+// incomingContext returns the context of a handler for a request carrying meta
+func incomingContext(ctx context.Context, meta map[string]string) context.Context {
+	ctx = extractSpanContext(ctx, meta)
+	if meta != nil {
+		ctx = context.WithValue(ctx, incomingMetadataKey{}, Metadata(meta))
+	}
+	return context.WithValue(ctx, trailerKey{}, &trailer{})
+}
+
+// responseMeta returns the trailer set by the handler of the request
+func responseMeta(ctx context.Context) map[string]string {
+	if t, ok := ctx.Value(trailerKey{}).(*trailer); ok {
+		return t.get()
+	}
+	return nil
+}
+
+// receiveTrailer stores the metadata of a response where WithTrailer asked for it
+func receiveTrailer(ctx context.Context, meta map[string]string) {
+	if md, ok := ctx.Value(trailerReceiverKey{}).(*Metadata); ok {
+		*md = Metadata(meta)
+	}
+}
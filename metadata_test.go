@@ -0,0 +1,41 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+type metadataImpl struct {
+}
+
+func (m *metadataImpl) Tenant(ctx context.Context) (string, error) {
+	SetTrailer(ctx, "served-by", "test")
+	return MetadataFromContext(ctx).Get("tenant"), nil
+}
+
+func TestMetadata(t *testing.T) {
+	server := NewServer()
+	server.Register("svc", &metadataImpl{})
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+
+	trailer := Metadata{}
+	ctx := WithMetadata(context.Background(), "tenant", "t1")
+	ctx = WithTrailer(ctx, &trailer)
+	result := ""
+	if err := conn.CallContext(ctx, "svc.Tenant", nil, &result); err != nil || result != "t1" {
+		t.Log(result, err)
+		t.Fail()
+		return
+	}
+	if trailer.Get("served-by") != "test" {
+		t.Log("trailer:", trailer)
+		t.Fail()
+	}
+	if OutgoingMetadata(context.Background()) != nil || OutgoingMetadata(ctx).Get("tenant") != "t1" {
+		t.Fail()
+	}
+}
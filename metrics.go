@@ -0,0 +1,291 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the latency histogram buckets in seconds
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const unknownMethod = "unknown"
+
+// Metrics collects rpc metrics and serves them in the prometheus text exposition format
+type Metrics struct {
+	Buckets []float64
+
+	lock       sync.Mutex
+	families   map[string]*metricFamily
+	collectors []func(m *Metrics)
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Buckets:  DefaultBuckets,
+		families: map[string]*metricFamily{},
+	}
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// series must be called with lock held
+func (m *Metrics) series(name, help, kind string, labels []string, values ...string) *metricSeries {
+	family, ok := m.families[name]
+	if !ok {
+		family = &metricFamily{name: name, help: help, kind: kind, labels: labels, series: map[string]*metricSeries{}}
+		if kind == "histogram" {
+			family.buckets = m.Buckets
+		}
+		m.families[name] = family
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: values}
+		if kind == "histogram" {
+			s.counts = make([]uint64, len(family.buckets))
+		}
+		family.series[key] = s
+	}
+	return s
+}
+
+func (m *Metrics) add(name, help, kind string, labels []string, delta float64, values ...string) {
+	m.lock.Lock()
+	m.series(name, help, kind, labels, values...).value += delta
+	m.lock.Unlock()
+}
+
+func (m *Metrics) set(name, help string, labels []string, value float64, values ...string) {
+	m.lock.Lock()
+	m.series(name, help, "gauge", labels, values...).value = value
+	m.lock.Unlock()
+}
+
+func (m *Metrics) observe(name, help string, labels []string, value float64, values ...string) {
+	m.lock.Lock()
+	s := m.series(name, help, "histogram", labels, values...)
+	family := m.families[name]
+	for i, bound := range family.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+	m.lock.Unlock()
+}
+
+// Collect registers a function called before every scrape, usually to set gauges
+func (m *Metrics) Collect(collector func(m *Metrics)) {
+	m.lock.Lock()
+	m.collectors = append(m.collectors, collector)
+	m.lock.Unlock()
+}
+
+// RegisterPool exports the stats of a pool as gauges labelled with target
+func (m *Metrics) RegisterPool(target string, stats func() PoolStats) {
+	labels := []string{"target"}
+	m.Collect(func(m *Metrics) {
+		s := stats()
+		m.set("jsonrpc_client_pool_open_connections", "Open connections of the pool.", labels, float64(s.Open), target)
+		m.set("jsonrpc_client_pool_in_flight_requests", "Calls in flight on the pool.", labels, float64(s.InFlight), target)
+		m.set("jsonrpc_client_pool_waiters", "Calls waiting for a connection of the pool.", labels, float64(s.Waiters), target)
+	})
+}
+
+// WriteTo writes all metrics in the text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.lock.Lock()
+	collectors := append([]func(*Metrics){}, m.collectors...)
+	m.lock.Unlock()
+	for _, collector := range collectors {
+		collector(m)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{Writer: bw}
+	for _, name := range names {
+		m.families[name].write(cw)
+	}
+	err := bw.Flush()
+	if cw.err != nil {
+		err = cw.err
+	}
+	return cw.n, err
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+type countWriter struct {
+	io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.Writer, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (f *metricFamily) write(w *countWriter) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			w.printf("%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			w.printf("%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "le", formatFloat(bound)), s.counts[i])
+		}
+		w.printf("%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "le", "+Inf"), s.count)
+		w.printf("%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatFloat(s.sum))
+		w.printf("%s_count%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	serverLabels      = []string{"method"}
+	serverErrorLabels = []string{"method", "code"}
+	clientLabels      = []string{"target", "method"}
+	clientErrorLabels = []string{"target", "method", "code"}
+)
+
+// MetricsHandler records server metrics of the requests passed to ServerHandler,
+// methods not found in Registry are labelled "unknown"
+type MetricsHandler struct {
+	Metrics  *Metrics
+	Registry Registry
+	ServerHandler
+}
+
+func (h *MetricsHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	method := request.Method
+	if _, ok := h.Registry.Find(method); !ok {
+		method = unknownMethod
+	}
+	m := h.Metrics
+	m.add("jsonrpc_server_requests_total", "Requests received by the server.", "counter", serverLabels, 1, method)
+	m.add("jsonrpc_server_in_flight_requests", "Requests being handled by the server.", "gauge", serverLabels, 1, method)
+	start := time.Now()
+	h.ServerHandler.Handle(request, &metricsWriter{ResponseWriter: writer, done: func(resp *ServerResponse) {
+		m.add("jsonrpc_server_in_flight_requests", "", "gauge", serverLabels, -1, method)
+		m.observe("jsonrpc_server_request_duration_seconds", "Latency of requests handled by the server.",
+			serverLabels, time.Since(start).Seconds(), method)
+		if resp.Error != nil {
+			m.add("jsonrpc_server_errors_total", "Error responses of the server by code.", "counter",
+				serverErrorLabels, 1, method, strconv.Itoa(int(resp.Error.Code)))
+		}
+	}})
+}
+
+type metricsWriter struct {
+	ResponseWriter
+	once sync.Once
+	done func(resp *ServerResponse)
+}
+
+func (w *metricsWriter) Write(resp *ServerResponse) {
+	w.once.Do(func() { w.done(resp) })
+	w.ResponseWriter.Write(resp)
+}
+
+// InstrumentSender records client metrics of the calls to target made through sender
+func InstrumentSender(m *Metrics, target string, sender Sender) Sender {
+	return func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+		m.add("jsonrpc_client_requests_total", "Calls made by the client.", "counter", clientLabels, 1, target, name)
+		m.add("jsonrpc_client_in_flight_requests", "Calls waiting for a response.", "gauge", clientLabels, 1, target, name)
+		start := time.Now()
+		err := sender(name, ctx, input, output)
+		m.add("jsonrpc_client_in_flight_requests", "", "gauge", clientLabels, -1, target, name)
+		m.observe("jsonrpc_client_request_duration_seconds", "Latency of calls made by the client.",
+			clientLabels, time.Since(start).Seconds(), target, name)
+		if err != nil {
+			m.add("jsonrpc_client_errors_total", "Failed calls of the client by code.", "counter",
+				clientErrorLabels, 1, target, name, errorCodeLabel(err))
+		}
+		return err
+	}
+}
+
+func errorCodeLabel(err error) string {
+	var respErr *Error
+	switch {
+	case errors.As(err, &respErr):
+		return strconv.Itoa(int(respErr.Code))
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "transport"
+	}
+}
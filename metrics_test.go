@@ -0,0 +1,51 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type writerForTest struct {
+	responses []*ServerResponse
+}
+
+func (w *writerForTest) Write(resp *ServerResponse) {
+	w.responses = append(w.responses, resp)
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	table := NewFunctionTable()
+	table.Register(serviceName, &Impl{})
+	handler := &MetricsHandler{Metrics: m, Registry: table, ServerHandler: table}
+	handler.Handle(&ServerRequest{Method: "halo.Add", Params: []json.RawMessage{json.RawMessage("4")}}, &writerForTest{})
+	handler.Handle(&ServerRequest{Method: "halo.Sub"}, &writerForTest{})
+
+	sender := InstrumentSender(m, "127.0.0.1:1", func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+		return errors.New("broken")
+	})
+	sender("halo.Add", context.Background(), nil, nil)
+	m.RegisterPool("127.0.0.1:1", func() PoolStats { return PoolStats{Open: 2} })
+
+	buf := &bytes.Buffer{}
+	m.WriteTo(buf)
+	out := buf.String()
+	for _, line := range []string{
+		`jsonrpc_server_requests_total{method="halo.Add"} 1`,
+		`jsonrpc_server_requests_total{method="unknown"} 1`,
+		`jsonrpc_server_errors_total{method="unknown",code="-32601"} 1`,
+		`jsonrpc_server_in_flight_requests{method="halo.Add"} 0`,
+		`jsonrpc_server_request_duration_seconds_count{method="halo.Add"} 1`,
+		`jsonrpc_client_errors_total{target="127.0.0.1:1",method="halo.Add",code="transport"} 1`,
+		`jsonrpc_client_pool_open_connections{target="127.0.0.1:1"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Log("missing:", line)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package jsonrpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OpenRPCVersion = "1.2.6"
+	DiscoverMethod = "rpc.discover"
+)
+
+// Schema is the subset of JSON Schema used to describe params and results
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type OpenRPCDocument struct {
+	OpenRPC    string             `json:"openrpc"`
+	Info       OpenRPCInfo        `json:"info"`
+	Methods    []OpenRPCMethod    `json:"methods"`
+	Components *OpenRPCComponents `json:"components,omitempty"`
+}
+
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenRPCMethod struct {
+	Name           string                     `json:"name"`
+	Description    string                     `json:"description,omitempty"`
+	Params         []OpenRPCContentDescriptor `json:"params"`
+	Result         *OpenRPCContentDescriptor  `json:"result,omitempty"`
+	ParamStructure string                     `json:"paramStructure,omitempty"`
+}
+
+type OpenRPCContentDescriptor struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type OpenRPCComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// schemaBuilder collects the schemas of named struct types as components
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	componentRefPrefix  = "#/components/schemas/"
+	componentNameEscape = strings.NewReplacer("[", "_", "]", "", "/", "_", ".", "_", "*", "", ",", "_", " ", "")
+)
+
+func (b *schemaBuilder) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return &Schema{Ref: componentRefPrefix + b.component(t)}
+	}
+	return &Schema{}
+}
+
+// component adds the schema of the named type t and returns its name
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := componentNameEscape.Replace(t.Name())
+	if _, taken := b.schemas[name]; taken {
+		name = componentNameEscape.Replace(t.PkgPath()) + "_" + name
+	}
+	b.names[t] = name
+	// placeholder for recursive types
+	b.schemas[name] = &Schema{}
+	*b.schemas[name] = *b.structSchema(t)
+	return name
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t, map[reflect.Type]bool{t: true})
+	sort.Strings(s.Required)
+	return s
+}
+
+// addFields adds the fields of t and of its embedded structs, visited stops a struct embedding itself
+// through a pointer, like encoding/json an embedded type is only walked once
+func (b *schemaBuilder) addFields(s *Schema, t reflect.Type, visited map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if !visited[fieldType] {
+				visited[fieldType] = true
+				b.addFields(s, fieldType, visited)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := b.schema(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			property.Description = doc
+		}
+		s.Properties[name] = property
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// describe returns the OpenRPC description of a method
+func (executor *FunctionExecutor) describe(b *schemaBuilder, name string, description string) OpenRPCMethod {
+	method := OpenRPCMethod{
+		Name:           name,
+		Description:    description,
+		Params:         []OpenRPCContentDescriptor{},
+		ParamStructure: "by-position",
+	}
+	for i, param := range executor.params {
+		method.Params = append(method.Params, OpenRPCContentDescriptor{
+			Name:     "arg" + strconv.Itoa(i),
+			Required: true,
+			Schema:   b.schema(param),
+		})
+	}
+	if executor.variadic != nil {
+		method.Params = append(method.Params, OpenRPCContentDescriptor{
+			Name:        "args",
+			Description: "variadic, may be repeated as trailing params",
+			Schema:      b.schema(executor.variadic),
+		})
+	}
+	result := &OpenRPCContentDescriptor{Name: "result"}
+	switch executor.shape {
+	case resultWithErrorReturn:
+		result.Schema = b.schema(executor.fn.Type().Out(0))
+	case replyWithErrorReturn:
+		result.Schema = b.schema(executor.reply)
+	default:
+		result.Schema = &Schema{Type: "null"}
+	}
+	method.Result = result
+	return method
+}
+
+// Methods returns the registered method names in order
+func (table *FunctionTable) Methods() []string {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	methods := make([]string, 0, len(table.functions))
+	for method := range table.functions {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// SetInfo sets the info of the OpenRPC document
+func (table *FunctionTable) SetInfo(info OpenRPCInfo) {
+	table.lock.Lock()
+	table.info = info
+	table.lock.Unlock()
+}
+
+// OpenRPC describes the registered methods, except rpc.discover
+func (table *FunctionTable) OpenRPC() *OpenRPCDocument {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	b := &schemaBuilder{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	doc := &OpenRPCDocument{OpenRPC: OpenRPCVersion, Info: table.info, Methods: []OpenRPCMethod{}}
+	names := make([]string, 0, len(table.functions))
+	for name := range table.functions {
+		if name != DiscoverMethod {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Methods = append(doc.Methods, table.functions[name].describe(b, name, table.options[name].Description))
+	}
+	if len(b.schemas) > 0 {
+		doc.Components = &OpenRPCComponents{Schemas: b.schemas}
+	}
+	return doc
+}
+
+// WriteOpenRPC writes the OpenRPC document as indented json
+func (table *FunctionTable) WriteOpenRPC(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(table.OpenRPC())
+}
+
+// WriteOpenRPCFile writes the OpenRPC document to filename
+func (table *FunctionTable) WriteOpenRPCFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = table.WriteOpenRPC(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// EnableDiscover serves the OpenRPC document of the table as rpc.discover, it is off by default
+// since the document tells every caller all methods and types
+func (table *FunctionTable) EnableDiscover() error {
+	return table.RegisterFunc(DiscoverMethod, table.discover)
+}
+
+func (table *FunctionTable) discover() (*OpenRPCDocument, error) {
+	return table.OpenRPC(), nil
+}
@@ -0,0 +1,112 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type addressForTest struct {
+	City string `json:"city" doc:"the city name"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type userForTest struct {
+	Name     string          `json:"name"`
+	Tags     []string        `json:"tags,omitempty"`
+	Address  *addressForTest `json:"address"`
+	Created  time.Time       `json:"created"`
+	Extra    map[string]int  `json:"extra,omitempty"`
+	Friends  []*userForTest  `json:"friends,omitempty"`
+	internal string
+	Skip     string `json:"-"`
+}
+
+type usersImpl struct{}
+
+func (usersImpl) Get(id int64) (*userForTest, error) { return &userForTest{}, nil }
+func (usersImpl) Delete(id int64) error              { return nil }
+
+func TestFunctionTable_OpenRPC(t *testing.T) {
+	table := NewFunctionTable()
+	table.Register("users", usersImpl{})
+	table.SetMethodOptions("users.Get", MethodOptions{Description: "get a user"})
+	doc := table.OpenRPC()
+	if len(doc.Methods) != 2 || doc.Methods[1].Name != "users.Get" || doc.Methods[1].Description != "get a user" {
+		t.Log(doc.Methods)
+		t.Fail()
+		return
+	}
+	get := doc.Methods[1]
+	if len(get.Params) != 1 || get.Params[0].Name != "arg0" || get.Params[0].Schema.Type != "integer" {
+		t.Log(get.Params)
+		t.Fail()
+	}
+	if get.Result.Schema.Ref != "#/components/schemas/userForTest" || doc.Methods[0].Result.Schema.Type != "null" {
+		t.Log(get.Result.Schema, doc.Methods[0].Result.Schema)
+		t.Fail()
+	}
+	user := doc.Components.Schemas["userForTest"]
+	if user == nil || !reflect.DeepEqual(user.Required, []string{"created", "name"}) || len(user.Properties) != 6 {
+		t.Log(user)
+		t.Fail()
+		return
+	}
+	if user.Properties["created"].Format != "date-time" || user.Properties["friends"].Items.Ref != "#/components/schemas/userForTest" {
+		t.Log(user.Properties)
+		t.Fail()
+	}
+	if address := doc.Components.Schemas["addressForTest"]; address == nil || address.Properties["city"].Description != "the city name" {
+		t.Log(address)
+		t.Fail()
+	}
+}
+
+func TestFunctionTable_Discover(t *testing.T) {
+	table := NewFunctionTable()
+	table.Register("users", usersImpl{})
+	writer := &syncWriterForTest{}
+	table.Handle(&ServerRequest{ID: 1, Method: DiscoverMethod}, writer)
+	if len(writer.responses) != 1 || writer.responses[0].Error == nil {
+		t.Log("discover is served before EnableDiscover")
+		t.Fail()
+		return
+	}
+	if err := table.EnableDiscover(); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	table.Handle(&ServerRequest{ID: 2, Method: DiscoverMethod}, writer)
+	if len(writer.responses) != 2 || writer.responses[1].Error != nil {
+		t.Log("no document")
+		t.Fail()
+		return
+	}
+	data, _ := json.Marshal(writer.responses[1].Result)
+	doc := &OpenRPCDocument{}
+	if err := json.Unmarshal(data, doc); err != nil || doc.OpenRPC != OpenRPCVersion || len(doc.Methods) != 2 {
+		t.Log(err, string(data))
+		t.Fail()
+	}
+}
+
+type nodeForTest struct {
+	*nodeForTest
+	Name string `json:"name"`
+}
+
+type nodesImpl struct{}
+
+func (nodesImpl) Root() (*nodeForTest, error) { return &nodeForTest{}, nil }
+
+func TestFunctionTable_OpenRPCSelfEmbedding(t *testing.T) {
+	table := NewFunctionTable()
+	table.Register("nodes", nodesImpl{})
+	node := table.OpenRPC().Components.Schemas["nodeForTest"]
+	if node == nil || len(node.Properties) != 1 || node.Properties["name"] == nil {
+		t.Log(node)
+		t.Fail()
+	}
+}
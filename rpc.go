@@ -11,6 +11,19 @@ type Caller interface {
 	Call(serviceMethod string, args []interface{}, reply interface{}) error
 }
 
+// ContextCaller is a Caller which can stop waiting for a response when ctx is done
+type ContextCaller interface {
+	Caller
+	CallContext(ctx context.Context, serviceMethod string, args []interface{}, reply interface{}) error
+}
+
+func callContext(ctx context.Context, caller Caller, serviceMethod string, args []interface{}, reply interface{}) error {
+	if c, ok := caller.(ContextCaller); ok {
+		return c.CallContext(ctx, serviceMethod, args, reply)
+	}
+	return caller.Call(serviceMethod, args, reply)
+}
+
 type CallerFactory func(ctx context.Context) (Caller, error)
 
 type Addr func() (string, error)
@@ -2,37 +2,281 @@ package jsonrpc
 
 import (
 	"context"
+	"io"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// PoolOptions controls the lifecycle of the connections held by a PoolSender,
+// the zero value keeps connections until they are broken
+type PoolOptions struct {
+	// connections older than MaxLifetime are rotated, in-flight calls are drained before closing
+	MaxLifetime time.Duration
+	// connections without calls for IdleTimeout are closed and redialed lazily
+	IdleTimeout time.Duration
+	// minimum interval between two dials of the pool
+	DialInterval time.Duration
+}
+
+// interval of the background check, 0 means no check is needed
+func (o *PoolOptions) checkInterval() time.Duration {
+	interval := o.MaxLifetime
+	if o.IdleTimeout > 0 && (interval == 0 || o.IdleTimeout < interval) {
+		interval = o.IdleTimeout
+	}
+	interval /= 2
+	if interval > 0 && interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+func (o *PoolOptions) expired(caller *pooledCaller, now time.Time) bool {
+	if o.MaxLifetime > 0 && now.Sub(caller.created) >= o.MaxLifetime {
+		return true
+	}
+	if o.IdleTimeout > 0 && atomic.LoadInt64(&caller.inflight) == 0 &&
+		now.Sub(time.Unix(0, atomic.LoadInt64(&caller.lastUsed))) >= o.IdleTimeout {
+		return true
+	}
+	return false
+}
+
+func (o *PoolOptions) wrap(factory CallerFactory) CallerFactory {
+	if o.DialInterval > 0 {
+		factory = limitDial(factory, o.DialInterval)
+	}
+	return func(ctx context.Context) (Caller, error) {
+		caller, err := factory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		return &pooledCaller{Caller: caller, created: now, lastUsed: now.UnixNano()}, nil
+	}
+}
+
+// limitDial spaces calls of factory at least interval apart
+func limitDial(factory CallerFactory, interval time.Duration) CallerFactory {
+	var lock sync.Mutex
+	var next time.Time
+	return func(ctx context.Context) (Caller, error) {
+		lock.Lock()
+		now := time.Now()
+		wait := next.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		next = now.Add(wait + interval)
+		lock.Unlock()
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		return factory(ctx)
+	}
+}
+
+// pooledCaller tracks usage of a pooled connection
+type pooledCaller struct {
+	Caller
+	created  time.Time
+	lastUsed int64
+	inflight int64
+	retired  int32
+	once     sync.Once
+}
+
+func (p *pooledCaller) Call(serviceMethod string, args []interface{}, reply interface{}) error {
+	atomic.AddInt64(&p.inflight, 1)
+	defer p.release()
+	return p.Caller.Call(serviceMethod, args, reply)
+}
+
+func (p *pooledCaller) CallContext(ctx context.Context, serviceMethod string, args []interface{}, reply interface{}) error {
+	atomic.AddInt64(&p.inflight, 1)
+	defer p.release()
+	return callContext(ctx, p.Caller, serviceMethod, args, reply)
+}
+
+func (p *pooledCaller) release() {
+	atomic.StoreInt64(&p.lastUsed, time.Now().UnixNano())
+	if atomic.AddInt64(&p.inflight, -1) == 0 && atomic.LoadInt32(&p.retired) == 1 {
+		p.close()
+	}
+}
+
+// retire closes the connection once all in-flight calls are finished
+func (p *pooledCaller) retire() {
+	atomic.StoreInt32(&p.retired, 1)
+	if atomic.LoadInt64(&p.inflight) == 0 {
+		p.close()
+	}
+}
+
+func (p *pooledCaller) isRetired() bool {
+	return atomic.LoadInt32(&p.retired) == 1
+}
+
+func (p *pooledCaller) close() {
+	p.once.Do(func() {
+		if closer, ok := p.Caller.(io.Closer); ok {
+			closer.Close()
+		}
+	})
+}
+
 type PoolSender struct {
-	callers []*LateInitCaller
-	size    int
-	times   uint64
+	callers   []*LateInitCaller
+	size      int
+	times     uint64
+	options   PoolOptions
+	waiters   int64
+	done      chan struct{}
+	closeOnce sync.Once
+	closed    int32
 }
 
 func NewFixedPool(size int, factory CallerFactory) *PoolSender {
+	return NewPool(size, factory, PoolOptions{})
+}
+
+func NewPool(size int, factory CallerFactory, options PoolOptions) *PoolSender {
 	cp := &PoolSender{
 		size:    size,
 		callers: make([]*LateInitCaller, size),
+		options: options,
+		done:    make(chan struct{}),
 	}
+	factory = options.wrap(factory)
 	for i := 0; i < size; i++ {
 		cp.callers[i] = &LateInitCaller{factory: factory}
 	}
+	if interval := options.checkInterval(); interval > 0 {
+		go cp.check(interval)
+	}
 	return cp
 }
 
 func (c *PoolSender) Send(method string, ctx context.Context, v []interface{}, resp interface{}) error {
-	delay := c.callers[atomic.AddUint64(&c.times, 1)%uint64(c.size)]
-	client, err := delay.Get(ctx)
+	index := atomic.AddUint64(&c.times, 1)
+	if hash, ok := routingHash(ctx); ok {
+		index = hash
+	}
+	delay := c.callers[index%uint64(c.size)]
+	client, err := c.get(ctx, delay)
 	if err != nil {
 		return err
 	}
-	err = client.Caller.Call( method, v, resp)
-	if err != nil {
-		if err == ErrShutdown {
-			delay.Clear(client.Version)
+	attempt := &sendAttempt{}
+	err = callContext(context.WithValue(ctx, sendAttemptKey{}, attempt), client.Caller, method, v, resp)
+	written := atomic.LoadInt32(&attempt.written) == 1
+	if written {
+		// keep the marker of a retry around this Send up to date
+		markWritten(ctx)
+	}
+	if err == ErrShutdown {
+		delay.Clear(client.Version)
+		// the connection was rotated before the request was written, the server never saw it
+		if pc, ok := client.Caller.(*pooledCaller); ok && pc.isRetired() && !written {
+			client, err = c.get(ctx, delay)
+			if err != nil {
+				return err
+			}
+			err = callContext(ctx, client.Caller, method, v, resp)
+			if err == ErrShutdown {
+				delay.Clear(client.Version)
+			}
 		}
 	}
 	return err
 }
+
+// Close stops the background check and closes all connections after their in-flight calls,
+// Send returns ErrShutdown afterwards
+func (c *PoolSender) Close() error {
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		close(c.done)
+		for _, caller := range c.callers {
+			c.retire(caller, func(*pooledCaller) bool { return true })
+		}
+	})
+	return nil
+}
+
+// Stats returns the current open connections, in-flight calls and calls waiting for a dial
+func (c *PoolSender) Stats() PoolStats {
+	stats := PoolStats{Waiters: atomic.LoadInt64(&c.waiters)}
+	for _, caller := range c.callers {
+		client, ok := caller.current()
+		if !ok {
+			continue
+		}
+		stats.Open++
+		if pc, ok := client.Caller.(*pooledCaller); ok {
+			stats.InFlight += atomic.LoadInt64(&pc.inflight)
+		}
+	}
+	return stats
+}
+
+func (c *PoolSender) get(ctx context.Context, caller *LateInitCaller) (VersionedCaller, error) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return emptyVersionedCaller, ErrShutdown
+	}
+	if _, ok := caller.current(); !ok {
+		atomic.AddInt64(&c.waiters, 1)
+		defer atomic.AddInt64(&c.waiters, -1)
+	}
+	client, err := caller.Get(ctx)
+	if err != nil {
+		return client, err
+	}
+	if atomic.LoadInt32(&c.closed) == 1 {
+		// dialed while Close was retiring the connections
+		c.retire(caller, func(*pooledCaller) bool { return true })
+		return emptyVersionedCaller, ErrShutdown
+	}
+	now := time.Now()
+	if c.retire(caller, func(pc *pooledCaller) bool { return c.options.expired(pc, now) }) {
+		return caller.Get(ctx)
+	}
+	return client, nil
+}
+
+// retire clears the current connection of caller if match returns true
+func (c *PoolSender) retire(caller *LateInitCaller, match func(*pooledCaller) bool) bool {
+	client, ok := caller.current()
+	if !ok {
+		return false
+	}
+	pc, ok := client.Caller.(*pooledCaller)
+	if !ok || !match(pc) {
+		return false
+	}
+	caller.Clear(client.Version)
+	pc.retire()
+	return true
+}
+
+func (c *PoolSender) check(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			for _, caller := range c.callers {
+				c.retire(caller, func(pc *pooledCaller) bool { return c.options.expired(pc, now) })
+			}
+		}
+	}
+}
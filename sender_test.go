@@ -0,0 +1,150 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type closableCallerForTest struct {
+	closed int32
+	block  chan struct{}
+}
+
+func (c *closableCallerForTest) Call(serviceMethod string, args []interface{}, reply interface{}) error {
+	if c.block != nil {
+		<-c.block
+	}
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return ErrShutdown
+	}
+	return nil
+}
+
+func (c *closableCallerForTest) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func TestPoolSender_MaxLifetime(t *testing.T) {
+	var lock sync.Mutex
+	var created []*closableCallerForTest
+	pool := NewPool(1, func(ctx context.Context) (Caller, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		c := &closableCallerForTest{}
+		created = append(created, c)
+		return c, nil
+	}, PoolOptions{MaxLifetime: 50 * time.Millisecond})
+	defer pool.Close()
+	ctx := context.Background()
+	if err := pool.Send("m", ctx, nil, nil); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	time.Sleep(80 * time.Millisecond)
+	if err := pool.Send("m", ctx, nil, nil); err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(created) != 2 || atomic.LoadInt32(&created[0].closed) != 1 {
+		t.Log("connections:", len(created))
+		t.Fail()
+	}
+}
+
+func TestPoolSender_DrainBeforeClose(t *testing.T) {
+	conn := &closableCallerForTest{block: make(chan struct{})}
+	pool := NewPool(1, func(ctx context.Context) (Caller, error) {
+		return conn, nil
+	}, PoolOptions{})
+	errs := make(chan error)
+	go func() {
+		errs <- pool.Send("m", context.Background(), nil, nil)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Close()
+	if atomic.LoadInt32(&conn.closed) != 0 {
+		t.Log("closed with a call in flight")
+		t.Fail()
+	}
+	close(conn.block)
+	if err := <-errs; err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if atomic.LoadInt32(&conn.closed) != 1 {
+		t.Log("not closed after drain")
+		t.Fail()
+	}
+}
+
+func TestPoolSender_SendAfterClose(t *testing.T) {
+	var dials int32
+	pool := NewPool(1, func(ctx context.Context) (Caller, error) {
+		atomic.AddInt32(&dials, 1)
+		return &closableCallerForTest{}, nil
+	}, PoolOptions{})
+	pool.Close()
+	if err := pool.Send("m", context.Background(), nil, nil); err != ErrShutdown {
+		t.Log("send after close:", err)
+		t.Fail()
+		return
+	}
+	if n := atomic.LoadInt32(&dials); n != 0 {
+		t.Log("dials after close:", n)
+		t.Fail()
+	}
+}
+
+type markingCallerForTest struct {
+	write bool
+	done  func()
+}
+
+func (c *markingCallerForTest) Call(serviceMethod string, args []interface{}, reply interface{}) error {
+	return c.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+func (c *markingCallerForTest) CallContext(ctx context.Context, serviceMethod string, args []interface{}, reply interface{}) error {
+	if c.done == nil {
+		return nil
+	}
+	if c.write {
+		markWritten(ctx)
+	}
+	c.done()
+	return ErrShutdown
+}
+
+func TestPoolSender_RetryOnlyUnwritten(t *testing.T) {
+	for _, write := range []bool{false, true} {
+		var dials int32
+		var pool *PoolSender
+		pool = NewPool(1, func(ctx context.Context) (Caller, error) {
+			if atomic.AddInt32(&dials, 1) > 1 {
+				return &markingCallerForTest{}, nil
+			}
+			// the first connection is rotated while the call is on it
+			return &markingCallerForTest{write: write, done: func() {
+				pool.retire(pool.callers[0], func(*pooledCaller) bool { return true })
+			}}, nil
+		}, PoolOptions{})
+		err := pool.Send("m", context.Background(), nil, nil)
+		pool.Close()
+		if write && (err != ErrShutdown || atomic.LoadInt32(&dials) != 1) {
+			t.Log("retried a written request:", err, atomic.LoadInt32(&dials))
+			t.Fail()
+		}
+		if !write && (err != nil || atomic.LoadInt32(&dials) != 2) {
+			t.Log("did not retry an unwritten request:", err, atomic.LoadInt32(&dials))
+			t.Fail()
+		}
+	}
+}
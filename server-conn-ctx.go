@@ -1,16 +1,50 @@
 package jsonrpc
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
+// ConnInfo describes the connection a request came from
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr net.Addr
+}
+
+func (info ConnInfo) key() string {
+	return strconv.FormatUint(info.ID, 10)
+}
+
+type connInfoKey struct{}
+
+var connSequence uint64
+
+// ConnInfoFromContext returns the connection of the request handled with ctx
+func ConnInfoFromContext(ctx context.Context) (ConnInfo, bool) {
+	info, ok := ctx.Value(connInfoKey{}).(ConnInfo)
+	return info, ok
+}
+
 func NewServerConnCtx(conn io.ReadWriteCloser, handler ServerHandler) *serverConnCtx {
+	info := ConnInfo{ID: atomic.AddUint64(&connSequence, 1)}
+	if addr, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		info.RemoteAddr = addr.RemoteAddr()
+	}
+	ctx := context.WithValue(context.Background(), connInfoKey{}, info)
+	ctx = context.WithValue(ctx, connStateKey{}, &connState{})
+	ctx, cancel := context.WithCancel(ctx)
 	return &serverConnCtx{
 		handler:         handler,
 		ReadWriteCloser: conn,
 		Decoder:         json.NewDecoder(conn),
 		Encoder:         json.NewEncoder(conn),
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 }
 
@@ -18,10 +52,14 @@ type serverConnCtx struct {
 	io.ReadWriteCloser
 	*json.Encoder
 	*json.Decoder
-	handler ServerHandler
+	handler     ServerHandler
+	ctx         context.Context
+	cancel      context.CancelFunc
+	writeLocker sync.Mutex
 }
 
 func (c *serverConnCtx) Read() {
+	defer c.cancel()
 	for {
 		req := &ServerRequest{}
 		err := c.Decode(req)
@@ -29,14 +67,45 @@ func (c *serverConnCtx) Read() {
 			c.Close()
 			return
 		}
+		req.ctx = incomingContext(c.ctx, req.Meta)
+		var writer ResponseWriter = c
+		if req.IsNotification() {
+			writer = discardWriter{}
+		}
+		if timeout := req.timeout(); timeout > 0 {
+			// the client sends the time left, so the deadline doesn't depend on the clocks agreeing
+			ctx, cancel := context.WithTimeout(req.ctx, timeout)
+			req.ctx = ctx
+			// maybe block
+			c.handler.Handle(req, &cancelWriter{ResponseWriter: writer, cancel: cancel})
+			continue
+		}
 		// maybe block
-		c.handler.Handle(req, c)
+		c.handler.Handle(req, writer)
 	}
 }
 
 func (c *serverConnCtx) Write(s *ServerResponse) {
+	c.writeLocker.Lock()
+	defer c.writeLocker.Unlock()
 	err := c.Encode(s)
 	if err != nil {
 		c.Close()
 	}
 }
+
+// cancelWriter releases the deadline of a request once it is answered
+type cancelWriter struct {
+	ResponseWriter
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(s *ServerResponse) {
+	w.ResponseWriter.Write(s)
+	w.cancel()
+}
+
+// discardWriter drops the response of a notification
+type discardWriter struct{}
+
+func (discardWriter) Write(*ServerResponse) {}
@@ -1,22 +1,88 @@
 package jsonrpc
 
-import "encoding/json"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+)
 
 type ServerRequest struct {
 	Version string            `json:"jsonrpc"`
 	Params  []json.RawMessage `json:"params"`
 	Method  string            `json:"method"`
 	ID      uint64            `json:"id"`
+	// envelope metadata, peers which don't know it ignore it
+	Meta map[string]string `json:"meta,omitempty"`
+	// milliseconds left before the deadline of the client
+	Timeout int64 `json:"timeout,omitempty"`
+
+	ctx          context.Context
+	notification bool
+}
+
+// UnmarshalJSON remembers if the id is missing, params sent by name as an object
+// become the only param, so a method taking one struct reads them
+func (r *ServerRequest) UnmarshalJSON(data []byte) error {
+	type plain ServerRequest
+	req := struct {
+		*plain
+		ID     *uint64         `json:"id"`
+		Params json.RawMessage `json:"params"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	r.notification = req.ID == nil
+	if req.ID != nil {
+		r.ID = *req.ID
+	}
+	r.Params = nil
+	params := bytes.TrimSpace(req.Params)
+	if len(params) > 0 && params[0] == '{' {
+		r.Params = []json.RawMessage{req.Params}
+		return nil
+	}
+	if len(params) > 0 {
+		return json.Unmarshal(params, &r.Params)
+	}
+	return nil
+}
+
+// IsNotification tells if the request has no id, its response is never sent
+func (r *ServerRequest) IsNotification() bool {
+	return r.notification
+}
+
+func (r *ServerRequest) timeout() time.Duration {
+	return time.Duration(r.Timeout) * time.Millisecond
+}
+
+// Context returns the context of the request, canceled when the connection is closed
+func (r *ServerRequest) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of r with its context changed to ctx
+func (r *ServerRequest) WithContext(ctx context.Context) *ServerRequest {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
 }
 
 type ServerResponse struct {
-	Version string         `json:"jsonrpc"`
-	Result  interface{}    `json:"result"`
-	Error   *responseError `json:"error"`
-	ID      uint64         `json:"id"`
+	Version string      `json:"jsonrpc"`
+	Result  interface{} `json:"result"`
+	Error   *Error      `json:"error"`
+	ID      uint64      `json:"id"`
+	// trailing metadata set by the handler with SetTrailer
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
-func CreateErrorResponse(id uint64, err *responseError) *ServerResponse {
+func CreateErrorResponse(id uint64, err *Error) *ServerResponse {
 	return &ServerResponse{
 		Version: Version,
 		Error:   err,
@@ -1,7 +1,9 @@
 package jsonrpc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -65,41 +67,160 @@ type Executor interface {
 	Execute(request *ServerRequest, writer ResponseWriter)
 }
 
-type FunctionExecutor reflect.Value
+type functionShape int
 
-func (executor FunctionExecutor) Execute(request *ServerRequest, writer ResponseWriter) {
-	fn := reflect.Value(executor)
-	inNum := fn.Type().NumIn()
-	args := []reflect.Value{}
+const (
+	// func(args...) (result, error)
+	resultWithErrorReturn functionShape = iota
+	// func(args...) error, the result is null
+	errorReturn
+	// net/rpc style func(args, reply *R) error
+	replyWithErrorReturn
+)
 
-	for i := 0; i < inNum; i++ {
-		arg := reflect.New(fn.Type().In(i))
-		json.Unmarshal(request.Params[i], arg.Interface())
-		args = append(args, arg.Elem())
+// FunctionExecutor calls a function with the params of a request,
+// an optional leading context.Context receives the context of the request
+type FunctionExecutor struct {
+	fn       reflect.Value
+	context  bool
+	params   []reflect.Type
+	variadic reflect.Type
+	reply    reflect.Type
+	shape    functionShape
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// NewFunctionExecutor checks the signature of fn, the error tells why fn can't be served
+func NewFunctionExecutor(fn reflect.Value) (*FunctionExecutor, error) {
+	if fn.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s is not a func", fn.Type())
+	}
+	typ := fn.Type()
+	executor := &FunctionExecutor{fn: fn}
+	switch {
+	case typ.NumOut() == 2 && typ.Out(1) == emptyErrorType:
+		executor.shape = resultWithErrorReturn
+		if !jsonType(typ.Out(0)) {
+			return nil, fmt.Errorf("result of type %s can't be encoded as json", typ.Out(0))
+		}
+	case typ.NumOut() == 1 && typ.Out(0) == emptyErrorType:
+		executor.shape = errorReturn
+	case typ.NumOut() == 0 || typ.Out(typ.NumOut()-1) != emptyErrorType:
+		return nil, errors.New("last result must be error")
+	default:
+		return nil, fmt.Errorf("returns %d values, want (result, error) or error", typ.NumOut())
 	}
 
+	in := make([]reflect.Type, typ.NumIn())
+	for i := range in {
+		in[i] = typ.In(i)
+	}
+	if len(in) > 0 && in[0] == contextType {
+		executor.context = true
+		in = in[1:]
+	}
+	if typ.IsVariadic() {
+		executor.variadic = in[len(in)-1].Elem()
+		in = in[:len(in)-1]
+	}
+	if executor.shape == errorReturn && executor.variadic == nil && len(in) == 2 && in[1].Kind() == reflect.Ptr {
+		executor.shape = replyWithErrorReturn
+		executor.reply = in[1].Elem()
+		in = in[:1]
+	}
+	for i, param := range in {
+		if param == contextType {
+			return nil, fmt.Errorf("context.Context must be the first parameter, found at %d", i)
+		}
+		if !jsonType(param) {
+			return nil, fmt.Errorf("parameter %d of type %s can't be decoded from json", i, param)
+		}
+	}
+	if executor.variadic != nil && !jsonType(executor.variadic) {
+		return nil, fmt.Errorf("variadic parameter of type %s can't be decoded from json", executor.variadic)
+	}
+	executor.params = in
+	return executor, nil
+}
+
+func jsonType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return false
+	}
+	return true
+}
+
+func (executor *FunctionExecutor) Execute(request *ServerRequest, writer ResponseWriter) {
 	defer recoverCallPanic(writer, request.ID)
-	resp := fn.Call(args)
-	if resp[1].IsNil() {
-		writer.Write(&ServerResponse{
-			ID:     request.ID,
-			Result: resp[0].Interface(),
-		})
-	} else {
+	args, err := executor.args(request)
+	if err != nil {
+		writer.Write(CreateErrorResponse(request.ID, &Error{Code: InvalidParamsCode, Message: err.Error()}))
+		return
+	}
+	var reply reflect.Value
+	if executor.shape == replyWithErrorReturn {
+		reply = reflect.New(executor.reply)
+		args = append(args, reply)
+	}
+
+	resp := executor.fn.Call(args)
+	if errValue := resp[len(resp)-1]; !errValue.IsNil() {
 		writer.Write(&ServerResponse{
-			ID: request.ID,
-			Error: &responseError{
-				Code:    ReturnErrorCode,
-				Message: fmt.Sprint(resp[1].Interface()),
-			},
+			ID:    request.ID,
+			Error: toError(errValue.Interface().(error)),
+			Meta:  responseMeta(request.Context()),
 		})
+		return
+	}
+	var result interface{}
+	switch executor.shape {
+	case resultWithErrorReturn:
+		result = resp[0].Interface()
+	case replyWithErrorReturn:
+		result = reply.Elem().Interface()
+	}
+	writer.Write(&ServerResponse{
+		ID:     request.ID,
+		Result: result,
+		Meta:   responseMeta(request.Context()),
+	})
+}
+
+// args decodes the params of request, missing params get their zero value
+func (executor *FunctionExecutor) args(request *ServerRequest) ([]reflect.Value, error) {
+	params := request.Params
+	if executor.variadic == nil && len(params) > len(executor.params) {
+		return nil, fmt.Errorf("too many params, want at most %d", len(executor.params))
+	}
+	args := make([]reflect.Value, 0, executor.fn.Type().NumIn()+len(params))
+	if executor.context {
+		args = append(args, reflect.ValueOf(request.Context()))
+	}
+	for i, typ := range executor.params {
+		arg := reflect.New(typ)
+		if i < len(params) {
+			if err := json.Unmarshal(params[i], arg.Interface()); err != nil {
+				return nil, fmt.Errorf("param %d: %v", i, err)
+			}
+		}
+		args = append(args, arg.Elem())
+	}
+	for i := len(executor.params); i < len(params); i++ {
+		arg := reflect.New(executor.variadic)
+		if err := json.Unmarshal(params[i], arg.Interface()); err != nil {
+			return nil, fmt.Errorf("param %d: %v", i, err)
+		}
+		args = append(args, arg.Elem())
 	}
+	return args, nil
 }
 
 func recoverCallPanic(writer ResponseWriter, ID uint64) {
 	panicThing := recover()
 	if panicThing != nil {
-		writer.Write(CreateErrorResponse(ID, &responseError{
+		writer.Write(CreateErrorResponse(ID, &Error{
 			Code:    PanicErrorCode,
 			Message: fmt.Sprint(panicThing),
 		}))
@@ -0,0 +1,214 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TraceParentKey = "traceparent"
+	TraceStateKey  = "tracestate"
+)
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+// SpanContext identifies a span, it travels as W3C traceparent and tracestate
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+func ParseTraceParent(traceParent string) (sc SpanContext, err error) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrInvalidTraceParent
+	}
+	var flags [1]byte
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceParent
+	}
+	if _, err = hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+	if _, err = hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+	if _, err = hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceParent
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// injectSpanContext adds the span context of ctx to the envelope metadata
+func injectSpanContext(ctx context.Context, meta map[string]string) map[string]string {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return meta
+	}
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[TraceParentKey] = sc.TraceParent()
+	if sc.TraceState != "" {
+		meta[TraceStateKey] = sc.TraceState
+	}
+	return meta
+}
+
+// extractSpanContext returns ctx with the remote span context carried by the envelope metadata
+func extractSpanContext(ctx context.Context, meta map[string]string) context.Context {
+	traceParent, ok := meta[TraceParentKey]
+	if !ok {
+		return ctx
+	}
+	sc, err := ParseTraceParent(traceParent)
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = meta[TraceStateKey]
+	return ContextWithSpanContext(ctx, sc)
+}
+
+type SpanKind int
+
+const (
+	SpanKindClient SpanKind = iota + 1
+	SpanKindServer
+)
+
+// Tracer starts spans around calls, an adapter for a tracing library implements it
+type Tracer interface {
+	// parent is the span context of the caller, invalid when there is none
+	StartSpan(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, Span)
+}
+
+type Span interface {
+	SpanContext() SpanContext
+	End(err error)
+}
+
+// TracingSender wraps sender so every call runs in a client span which is propagated to the server
+func TracingSender(tracer Tracer, sender Sender) Sender {
+	return func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+		parent, _ := SpanContextFromContext(ctx)
+		ctx, span := tracer.StartSpan(ctx, name, SpanKindClient, parent)
+		ctx = ContextWithSpanContext(ctx, span.SpanContext())
+		err := sender(name, ctx, input, output)
+		span.End(err)
+		return err
+	}
+}
+
+// TracingHandler runs every request in a server span, child of the span of the client
+type TracingHandler struct {
+	Tracer Tracer
+	ServerHandler
+}
+
+func (h *TracingHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	parent, _ := SpanContextFromContext(request.Context())
+	ctx, span := h.Tracer.StartSpan(request.Context(), request.Method, SpanKindServer, parent)
+	ctx = ContextWithSpanContext(ctx, span.SpanContext())
+	h.ServerHandler.Handle(request.WithContext(ctx), &tracingWriter{ResponseWriter: writer, span: span})
+}
+
+type tracingWriter struct {
+	ResponseWriter
+	once sync.Once
+	span Span
+}
+
+func (w *tracingWriter) Write(resp *ServerResponse) {
+	w.once.Do(func() {
+		if resp.Error != nil {
+			w.span.End(resp.Error)
+		} else {
+			w.span.End(nil)
+		}
+	})
+	w.ResponseWriter.Write(resp)
+}
+
+// SpanRecorder is a Tracer which keeps finished spans in memory, for tests
+type SpanRecorder struct {
+	lock  sync.Mutex
+	spans []RecordedSpan
+}
+
+type RecordedSpan struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Err         error
+}
+
+func (r *SpanRecorder) StartSpan(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, Span) {
+	sc := SpanContext{Flags: 1}
+	if parent.IsValid() {
+		sc.TraceID, sc.Flags, sc.TraceState = parent.TraceID, parent.Flags, parent.TraceState
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	return ctx, &recorderSpan{
+		recorder: r,
+		span:     RecordedSpan{Name: name, Kind: kind, SpanContext: sc, Parent: parent, Start: time.Now()},
+	}
+}
+
+// Spans returns the finished spans in the order they ended
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+type recorderSpan struct {
+	recorder *SpanRecorder
+	span     RecordedSpan
+}
+
+func (s *recorderSpan) SpanContext() SpanContext {
+	return s.span.SpanContext
+}
+
+func (s *recorderSpan) End(err error) {
+	s.span.End = time.Now()
+	s.span.Err = err
+	s.recorder.lock.Lock()
+	s.recorder.spans = append(s.recorder.spans, s.span)
+	s.recorder.lock.Unlock()
+}
@@ -0,0 +1,74 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+type tracedImpl struct {
+	spans chan SpanContext
+}
+
+func (t *tracedImpl) Echo(ctx context.Context, s string) (string, error) {
+	sc, _ := SpanContextFromContext(ctx)
+	t.spans <- sc
+	return s, nil
+}
+
+func TestTracing(t *testing.T) {
+	recorder := &SpanRecorder{}
+	impl := &tracedImpl{spans: make(chan SpanContext, 1)}
+	server := NewServer()
+	server.Register("svc", impl)
+	server.ServerHandler = &TracingHandler{Tracer: recorder, ServerHandler: server.ServerHandler}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	conn := NewClientConn(clientConn)
+	defer conn.Close()
+	sender := TracingSender(recorder, func(name string, ctx context.Context, input []interface{}, output interface{}) error {
+		return conn.CallContext(ctx, name, input, output)
+	})
+
+	result := ""
+	if err := sender("svc.Echo", context.Background(), []interface{}{"hi"}, &result); err != nil || result != "hi" {
+		t.Log(result, err)
+		t.Fail()
+		return
+	}
+	handlerSpan := <-impl.spans
+	spans := recorder.Spans()
+	if len(spans) != 2 {
+		t.Log("spans:", len(spans))
+		t.Fail()
+		return
+	}
+	serverSpan, clientSpan := spans[0], spans[1]
+	if serverSpan.Kind != SpanKindServer || clientSpan.Kind != SpanKindClient {
+		t.Fail()
+	}
+	if serverSpan.Parent.SpanID != clientSpan.SpanContext.SpanID ||
+		serverSpan.SpanContext.TraceID != clientSpan.SpanContext.TraceID {
+		t.Log("server span is not a child of the client span")
+		t.Fail()
+	}
+	if handlerSpan.SpanID != serverSpan.SpanContext.SpanID {
+		t.Log("handler context doesn't carry the server span")
+		t.Fail()
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(traceParent)
+	if err != nil || sc.TraceParent() != traceParent {
+		t.Log(sc.TraceParent(), err)
+		t.Fail()
+	}
+	for _, invalid := range []string{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Log("accepted:", invalid)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package jsonrpc
+
+import (
+	"sync"
+	"time"
+)
+
+// OverloadPolicy decides what a WorkerPoolHandler does with a request when its queue is full
+type OverloadPolicy int
+
+const (
+	// answer the request with OverServerLimitError
+	OverloadReject OverloadPolicy = iota
+	// block the reader of the connection until there is room, which pushes back on the client through tcp
+	OverloadBlock
+	// answer the oldest queued request with OverServerLimitError and queue the new one
+	OverloadDropOldest
+)
+
+type WorkerPoolOptions struct {
+	// workers always running
+	Workers int
+	// more than Workers makes the pool elastic, extra workers exit after IdleTimeout without work
+	MaxWorkers  int
+	IdleTimeout time.Duration
+	// requests waiting for a worker
+	QueueSize int
+	Policy    OverloadPolicy
+	// queue per connection and serve the connections in turn, so one client can't starve the others
+	Fair bool
+}
+
+type queuedRequest struct {
+	request *ServerRequest
+	writer  ResponseWriter
+}
+
+type connQueue struct {
+	key   uint64
+	items []queuedRequest
+}
+
+// WorkerPoolHandler runs requests on a bounded number of workers, ServerHandler should be synchronous
+type WorkerPoolHandler struct {
+	ServerHandler
+	options  WorkerPoolOptions
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	// connections with queued requests in serving order
+	queues  []*connQueue
+	byKey   map[uint64]*connQueue
+	size    int
+	workers int
+	idle    int
+	closed  bool
+}
+
+func NewWorkerPoolHandler(handler ServerHandler, options WorkerPoolOptions) *WorkerPoolHandler {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	if options.MaxWorkers < options.Workers {
+		options.MaxWorkers = options.Workers
+	}
+	if options.QueueSize < 1 {
+		options.QueueSize = options.MaxWorkers
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = time.Minute
+	}
+	h := &WorkerPoolHandler{
+		ServerHandler: handler,
+		options:       options,
+		byKey:         map[uint64]*connQueue{},
+	}
+	h.notEmpty = sync.NewCond(&h.lock)
+	h.notFull = sync.NewCond(&h.lock)
+	h.lock.Lock()
+	for i := 0; i < options.Workers; i++ {
+		h.workers++
+		go h.work(false)
+	}
+	h.lock.Unlock()
+	if options.MaxWorkers > options.Workers {
+		go h.wakeIdle()
+	}
+	return h
+}
+
+func (h *WorkerPoolHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	h.lock.Lock()
+	for !h.closed && h.size >= h.options.QueueSize && h.options.Policy != OverloadReject {
+		if h.options.Policy == OverloadBlock {
+			h.notFull.Wait()
+			continue
+		}
+		dropped := h.dropOldest()
+		h.lock.Unlock()
+		dropped.writer.Write(CreateErrorResponse(dropped.request.ID, OverServerLimitError))
+		h.lock.Lock()
+	}
+	if h.closed || h.size >= h.options.QueueSize {
+		h.lock.Unlock()
+		writer.Write(CreateErrorResponse(request.ID, OverServerLimitError))
+		return
+	}
+	h.push(queuedRequest{request: request, writer: writer})
+	if h.idle == 0 && h.workers < h.options.MaxWorkers {
+		h.workers++
+		go h.work(true)
+	}
+	h.notEmpty.Signal()
+	h.lock.Unlock()
+}
+
+// Close stops the workers once the queued requests are done, later requests are rejected
+func (h *WorkerPoolHandler) Close() error {
+	h.lock.Lock()
+	h.closed = true
+	h.notEmpty.Broadcast()
+	h.notFull.Broadcast()
+	h.lock.Unlock()
+	return nil
+}
+
+// Queued returns the requests waiting for a worker
+func (h *WorkerPoolHandler) Queued() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.size
+}
+
+func (h *WorkerPoolHandler) key(request *ServerRequest) uint64 {
+	if !h.options.Fair {
+		return 0
+	}
+	info, _ := ConnInfoFromContext(request.Context())
+	return info.ID
+}
+
+// push must be called with lock held
+func (h *WorkerPoolHandler) push(item queuedRequest) {
+	key := h.key(item.request)
+	queue, ok := h.byKey[key]
+	if !ok {
+		queue = &connQueue{key: key}
+		h.byKey[key] = queue
+		h.queues = append(h.queues, queue)
+	}
+	queue.items = append(queue.items, item)
+	h.size++
+}
+
+// pop takes the next request of the first connection and moves the connection to the back, must be called with lock held
+func (h *WorkerPoolHandler) pop() queuedRequest {
+	queue := h.queues[0]
+	h.queues = h.queues[1:]
+	item := queue.items[0]
+	queue.items[0] = queuedRequest{}
+	queue.items = queue.items[1:]
+	if len(queue.items) > 0 {
+		h.queues = append(h.queues, queue)
+	} else {
+		delete(h.byKey, queue.key)
+	}
+	h.size--
+	h.notFull.Signal()
+	return item
+}
+
+// dropOldest removes the oldest request of the longest queue, must be called with lock held
+func (h *WorkerPoolHandler) dropOldest() queuedRequest {
+	longest := 0
+	for i, queue := range h.queues {
+		if len(queue.items) > len(h.queues[longest].items) {
+			longest = i
+		}
+	}
+	queue := h.queues[longest]
+	item := queue.items[0]
+	queue.items[0] = queuedRequest{}
+	queue.items = queue.items[1:]
+	if len(queue.items) == 0 {
+		h.queues = append(h.queues[:longest:longest], h.queues[longest+1:]...)
+		delete(h.byKey, queue.key)
+	}
+	h.size--
+	return item
+}
+
+func (h *WorkerPoolHandler) work(elastic bool) {
+	h.lock.Lock()
+	for {
+		idleSince := time.Now()
+		for h.size == 0 && !h.closed {
+			if elastic && time.Since(idleSince) >= h.options.IdleTimeout {
+				h.workers--
+				h.lock.Unlock()
+				return
+			}
+			h.idle++
+			h.notEmpty.Wait()
+			h.idle--
+		}
+		if h.size == 0 {
+			h.workers--
+			h.lock.Unlock()
+			return
+		}
+		item := h.pop()
+		h.lock.Unlock()
+		h.ServerHandler.Handle(item.request, item.writer)
+		h.lock.Lock()
+	}
+}
+
+// wakeIdle wakes idle workers from time to time so extra ones can exit
+func (h *WorkerPoolHandler) wakeIdle() {
+	ticker := time.NewTicker(h.options.IdleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.lock.Lock()
+		closed := h.closed
+		if h.workers > h.options.Workers {
+			h.notEmpty.Broadcast()
+		}
+		h.lock.Unlock()
+		if closed {
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordHandler struct {
+	lock    sync.Mutex
+	handled []uint64
+	block   chan struct{}
+}
+
+func (h *recordHandler) Handle(request *ServerRequest, writer ResponseWriter) {
+	if h.block != nil {
+		<-h.block
+	}
+	h.lock.Lock()
+	h.handled = append(h.handled, request.ID)
+	h.lock.Unlock()
+	writer.Write(&ServerResponse{ID: request.ID})
+}
+
+type syncWriterForTest struct {
+	lock      sync.Mutex
+	responses []*ServerResponse
+}
+
+func (w *syncWriterForTest) Write(resp *ServerResponse) {
+	w.lock.Lock()
+	w.responses = append(w.responses, resp)
+	w.lock.Unlock()
+}
+
+func (w *syncWriterForTest) errors() (ids []uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, resp := range w.responses {
+		if resp.Error != nil {
+			ids = append(ids, resp.ID)
+		}
+	}
+	return
+}
+
+func requestOfConn(id uint64, conn uint64) *ServerRequest {
+	ctx := context.WithValue(context.Background(), connInfoKey{}, ConnInfo{ID: conn})
+	return (&ServerRequest{ID: id}).WithContext(ctx)
+}
+
+func TestWorkerPoolHandler_Reject(t *testing.T) {
+	inner := &recordHandler{block: make(chan struct{})}
+	h := NewWorkerPoolHandler(inner, WorkerPoolOptions{Workers: 1, QueueSize: 1})
+	defer h.Close()
+	writer := &syncWriterForTest{}
+	h.Handle(requestOfConn(1, 1), writer)
+	time.Sleep(10 * time.Millisecond)
+	h.Handle(requestOfConn(2, 1), writer)
+	h.Handle(requestOfConn(3, 1), writer)
+	if ids := writer.errors(); len(ids) != 1 || ids[0] != 3 {
+		t.Log("rejected:", ids)
+		t.Fail()
+	}
+	close(inner.block)
+}
+
+func TestWorkerPoolHandler_DropOldest(t *testing.T) {
+	inner := &recordHandler{block: make(chan struct{})}
+	h := NewWorkerPoolHandler(inner, WorkerPoolOptions{Workers: 1, QueueSize: 1, Policy: OverloadDropOldest})
+	defer h.Close()
+	writer := &syncWriterForTest{}
+	h.Handle(requestOfConn(1, 1), writer)
+	time.Sleep(10 * time.Millisecond)
+	h.Handle(requestOfConn(2, 1), writer)
+	h.Handle(requestOfConn(3, 1), writer)
+	if ids := writer.errors(); len(ids) != 1 || ids[0] != 2 {
+		t.Log("dropped:", ids)
+		t.Fail()
+	}
+	close(inner.block)
+}
+
+func TestWorkerPoolHandler_Block(t *testing.T) {
+	inner := &recordHandler{block: make(chan struct{})}
+	h := NewWorkerPoolHandler(inner, WorkerPoolOptions{Workers: 1, QueueSize: 1, Policy: OverloadBlock})
+	defer h.Close()
+	writer := &syncWriterForTest{}
+	h.Handle(requestOfConn(1, 1), writer)
+	time.Sleep(10 * time.Millisecond)
+	h.Handle(requestOfConn(2, 1), writer)
+	returned := make(chan struct{})
+	go func() {
+		h.Handle(requestOfConn(3, 1), writer)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+		t.Log("Handle didn't block")
+		t.Fail()
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(inner.block)
+	<-returned
+}
+
+func TestWorkerPoolHandler_Fair(t *testing.T) {
+	inner := &recordHandler{block: make(chan struct{})}
+	h := NewWorkerPoolHandler(inner, WorkerPoolOptions{Workers: 1, QueueSize: 100, Fair: true})
+	defer h.Close()
+	writer := &syncWriterForTest{}
+	h.Handle(requestOfConn(1, 1), writer)
+	time.Sleep(10 * time.Millisecond)
+	for i := uint64(2); i <= 10; i++ {
+		h.Handle(requestOfConn(i, 1), writer)
+	}
+	h.Handle(requestOfConn(100, 2), writer)
+	close(inner.block)
+	for h.Queued() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	inner.lock.Lock()
+	defer inner.lock.Unlock()
+	if len(inner.handled) != 11 || inner.handled[2] != 100 {
+		t.Log("order:", inner.handled)
+		t.Fail()
+	}
+}